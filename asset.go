@@ -6,26 +6,31 @@ package combine
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
+	"html"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/pkg/errors"
 	"github.com/tdewolff/minify"
-	"github.com/tdewolff/minify/css"
-	"github.com/tdewolff/minify/js"
+	"github.com/tdewolff/parse/js"
 )
 
 type asset struct {
 	reg   *Box
 	kind  string
 	media []uint32
+	opts  uint32
 }
 
 // StringCombiner ...
@@ -39,6 +44,8 @@ type File interface {
 	Aggregator
 	Tagger
 	StringCombiner
+	// UseMinifier defines the minifier of the asset.
+	UseMinifier(m minify.Minifier) (File, error)
 }
 
 // Aggregator is the interface implemented by asset to add content inside.
@@ -55,7 +62,34 @@ type Aggregator interface {
 	AddString(str ...string) error
 	// AddURL stores the file URLs as future part of the asset.
 	// An error is returned is one URL is invalid.
+	// The data and file URLs are respectively added as inline and file content.
 	AddURL(url ...string) error
+	// AddFallback adds one part of the asset with a list of alternative sources.
+	// They are tried in turn to combine the asset until one of them is available.
+	// An error is returned if one of the sources is invalid.
+	AddFallback(src ...Source) error
+}
+
+// Source represents one of the alternative sources of a part of the asset.
+type Source struct {
+	kind  int
+	value string
+}
+
+// FileSource returns a source to the given local file,
+// relative to the source directory of the box.
+func FileSource(name string) Source {
+	return Source{kind: fileSrc, value: name}
+}
+
+// StringSource returns a source with the given inline content.
+func StringSource(s string) Source {
+	return Source{kind: inlineSrc, value: s}
+}
+
+// URLSource returns a source to the given URL.
+func URLSource(url string) Source {
+	return Source{kind: onlineSrc, value: url}
 }
 
 // Add adds a slice of byte as part of the asset.
@@ -77,16 +111,11 @@ func (a *asset) Add(buf ...[]byte) (err error) {
 // Only checks stats to verify if it exists.
 // If not, an error is returned.
 func (a *asset) AddFile(name ...string) (err error) {
+	var c *raw
 	for _, name := range name {
-		file := Dir(name)
-		if file.String() == "." {
-			return ErrUnexpectedEOF
-		}
-		name = filepath.Join(a.reg.src.String(), file.String())
-		if _, err = os.Stat(name); err != nil {
+		if c, err = a.newFile(name); err != nil {
 			return
 		}
-		c := &raw{kind: fileSrc, buf: []byte(name)}
 		if err = a.append(c); err != nil {
 			return
 		}
@@ -94,6 +123,18 @@ func (a *asset) AddFile(name ...string) (err error) {
 	return
 }
 
+func (a *asset) newFile(name string) (*raw, error) {
+	file := Dir(name)
+	if file.String() == "." {
+		return nil, ErrUnexpectedEOF
+	}
+	name = filepath.Join(a.reg.src.String(), file.String())
+	if _, err := os.Stat(name); err != nil {
+		return nil, err
+	}
+	return &raw{kind: fileSrc, buf: []byte(name)}, nil
+}
+
 // AddString adds each string as part of the asset.
 // An error is returned if we fails to deal with it.
 func (a *asset) AddString(s ...string) (err error) {
@@ -111,16 +152,18 @@ func (a *asset) AddString(s ...string) (err error) {
 
 // AddURL stores the file URLs as future part of the asset.
 // An error is returned is one URL is invalid.
+// The data URLs are decoded and added as inline content,
+// the file URLs are managed like a call to AddFile.
 func (a *asset) AddURL(rawURL ...string) error {
 	for _, rawURL := range rawURL {
-		if rawURL = strings.TrimSpace(rawURL); rawURL == "" {
-			return ErrUnexpectedEOF
-		}
-		u, err := url.Parse(rawURL)
+		c, err := a.newURL(rawURL)
 		if err != nil {
 			return err
 		}
-		c := &raw{kind: onlineSrc, buf: []byte(u.String())}
+		if c == nil {
+			// Empty data URL, nothing to add.
+			continue
+		}
 		if err = a.append(c); err != nil {
 			return err
 		}
@@ -128,7 +171,107 @@ func (a *asset) AddURL(rawURL ...string) error {
 	return nil
 }
 
+func (a *asset) newURL(rawURL string) (*raw, error) {
+	if rawURL = strings.TrimSpace(rawURL); rawURL == "" {
+		return nil, ErrUnexpectedEOF
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "data":
+		buf, err := dataURL(rawURL)
+		if err != nil || len(buf) == 0 {
+			return nil, err
+		}
+		return &raw{kind: inlineSrc, buf: buf}, nil
+	case "file":
+		if h := u.Hostname(); h != "" && !strings.EqualFold(h, "localhost") {
+			// Only the local files are managed.
+			return nil, ErrHost
+		}
+		name := u.Path
+		if name == "" {
+			// Relative path like file:f1.css
+			name = u.Opaque
+		}
+		return a.newFile(filepath.FromSlash(name))
+	}
+	return &raw{kind: onlineSrc, buf: []byte(u.String())}, nil
+}
+
+// dataURL returns the data behind the given data URL.
+// See RFC 2397 for the syntax: data:[<mediatype>][;base64],<data>
+func dataURL(rawURL string) ([]byte, error) {
+	i := strings.IndexByte(rawURL, ',')
+	if i < 0 {
+		return nil, ErrUnexpectedEOF
+	}
+	data, err := url.PathUnescape(rawURL[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(strings.ToLower(rawURL[:i]), ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return []byte(data), nil
+}
+
+// AddFallback adds one part of the asset with a list of alternative sources.
+// They are tried in turn to combine the asset until one of them is available.
+// An error is returned if one of the sources is invalid.
+func (a *asset) AddFallback(src ...Source) error {
+	var alt []*raw
+	for _, s := range src {
+		c, err := a.newSource(s)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			alt = append(alt, c)
+		}
+	}
+	switch len(alt) {
+	case 0:
+		return ErrUnexpectedEOF
+	case 1:
+		return a.append(alt[0])
+	}
+	// The identifier of the part is based on all of its alternatives,
+	// whichever is used to build it.
+	desc := make([]string, len(alt))
+	for i, c := range alt {
+		desc[i] = strconv.Itoa(c.kind) + ":" + c.String()
+	}
+	return a.append(&raw{kind: fallbackSrc, buf: []byte(strings.Join(desc, "\n")), alt: alt})
+}
+
+func (a *asset) newSource(s Source) (*raw, error) {
+	switch s.kind {
+	case fileSrc:
+		return a.newFile(s.value)
+	case onlineSrc:
+		return a.newURL(s.value)
+	}
+	if s.value = strings.TrimSpace(s.value); s.value == "" {
+		return nil, nil
+	}
+	return &raw{kind: inlineSrc, buf: []byte(s.value)}, nil
+}
+
 func (a *asset) append(r *raw) (err error) {
+	c := r
+	if c.kind == fallbackSrc {
+		// Only the first source is rendered by SrcTags.
+		c = c.alt[0]
+	}
+	if c.kind == inlineSrc {
+		// Its content must be able to be rendered inline.
+		if _, err = inlineText(a.kind, c.buf); err != nil {
+			return err
+		}
+	}
 	var key uint32
 	if key, err = r.crc(); err != nil {
 		return err
@@ -147,71 +290,294 @@ type Combiner interface {
 
 // Combine tries to write the result of all combined and minified
 // parts of the content of the asset to w or returns an error.
+// In development mode, the parts are not minified but preceded
+// by a comment naming their origin.
 func (a *asset) Combine(w io.Writer) error {
-	m, err := newMinify(a.kind)
+	_, err := a.combine(w, nil, nil)
+	return err
+}
+
+// combine does the job of Combine and also returns by part index
+// the origin of each alternative source used instead of the first one.
+// The parts are fetched and minified concurrently, but written in order.
+// The first error cancels the remaining work.
+// If sm is not nil, each part is added to this source map.
+// If lic is not nil, the license comments of the parts are written to it.
+func (a *asset) combine(w io.Writer, sm *sourceMap, lic *bytes.Buffer) (fallbacks map[int]string, err error) {
+	m, err := a.newMinify()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+		parts    = make([]*part, len(a.media))
+		sem      = make(chan struct{}, a.reg.fetchLimit)
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
 	}
 	for i := 0; i < len(a.media); i++ {
-		r, ok := a.reg.loadRaw(a.media[i])
-		if !ok {
-			return ErrNotFound
+		parts[i] = &part{done: make(chan struct{})}
+		go func(p *part, index int, key uint32) {
+			defer close(p.done)
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				p.err = ctx.Err()
+				return
+			}
+			var ok bool
+			if p.src, ok = a.reg.loadRaw(key); !ok {
+				p.err = ErrNotFound
+			} else {
+				p.c, p.used, p.err = a.minify(ctx, p.src, m)
+			}
+			if p.err != nil {
+				fail(newSourceError(index, p.src, p.err))
+			}
+		}(parts[i], i, a.media[i])
+	}
+	for i, p := range parts {
+		<-p.done
+		if p.err != nil {
+			// Waits for the first error, the one which has canceled the others.
+			once.Do(func() {})
+			return nil, firstErr
 		}
-		switch r.kind {
-		case fileSrc:
-			if err := a.minifyFile(r, m, w); err != nil {
-				return errors.Wrap(ErrNotFound, err.Error())
+		if p.src.kind == fallbackSrc && p.used != p.src.alt[0] {
+			if fallbacks == nil {
+				fallbacks = make(map[int]string)
 			}
-		case onlineSrc:
-			if err := a.minifyURL(r, m, w); err != nil {
-				return errors.Wrap(ErrNotFound, err.Error())
+			fallbacks[i] = p.used.origin()
+		}
+		if lic != nil {
+			_, _ = lic.Write(p.c.lic)
+		} else if a.reg.license == KeepLicense && !a.reg.dev && len(p.c.lic) > 0 {
+			// In development mode, the comments are already there.
+			if sm != nil {
+				sm.move(p.c.lic)
 			}
-		default:
-			if err := a.minify(r, m, w); err != nil {
-				return errors.Wrap(ErrNotFound, err.Error())
+			if _, err = w.Write(p.c.lic); err != nil {
+				return nil, err
 			}
 		}
+		if a.reg.dev {
+			b := banner(p.used, i)
+			if sm != nil {
+				sm.move(b)
+			}
+			if _, err = w.Write(b); err != nil {
+				return nil, err
+			}
+		}
+		if sm != nil {
+			sm.add(a.mapSource(i, p.used, p.c), p.c.buf)
+		}
+		if _, err = w.Write(p.c.buf); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return fallbacks, nil
 }
 
-func newMinify(mimeType string) (m *minify.M, err error) {
-	m = minify.New()
-	switch mimeType {
-	case JavaScript:
-		m.AddFunc(mimeType, js.Minify)
-	case CSS:
-		m.AddFunc(mimeType, css.Minify)
-	default:
-		err = ErrMime
+// banner returns the comment naming the origin of the part in development mode.
+func banner(r *raw, index int) []byte {
+	s := r.origin()
+	if r.kind == inlineSrc {
+		s += " #" + strconv.Itoa(index)
 	}
-	return
+	// Prevents the end of the comment.
+	s = strings.Replace(s, "*/", "*\\/", -1)
+	return []byte("/* " + s + " */\n")
+}
+
+// part represents a part of an asset being minified.
+type part struct {
+	src, used *raw
+	c         *cached
+	err       error
+	done      chan struct{}
 }
 
-func (a *asset) minify(r *raw, m *minify.M, w io.Writer) error {
-	return m.Minify(a.kind, w, bytes.NewReader(r.buf))
+// minify returns the minified content of the raw source and the raw really used to get it.
+// With a fallback source, it's the first of its alternatives available.
+func (a *asset) minify(ctx context.Context, r *raw, m *minify.M) (c *cached, used *raw, err error) {
+	if r.kind != fallbackSrc {
+		c, err = a.load(ctx, r, m)
+		return c, r, err
+	}
+	for _, alt := range r.alt {
+		if c, err = a.load(ctx, alt, m); err == nil {
+			return c, alt, nil
+		}
+	}
+	return nil, nil, err
 }
 
-func (a *asset) minifyFile(r *raw, m *minify.M, w io.Writer) error {
-	file, err := os.Open(r.String())
+// load returns the minified content of the raw source.
+// The minified version is kept in the cache of the box to be shared by all assets,
+// and reused while the source stays unchanged.
+func (a *asset) load(ctx context.Context, r *raw, m *minify.M) (*cached, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key, err := a.cacheKey(r)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var (
+		src  io.ReadCloser
+		next = &cached{}
+	)
+	prev, _ := a.reg.loadCache(key)
+	switch r.kind {
+	case fileSrc:
+		fi, err := os.Stat(r.String())
+		if err != nil {
+			return nil, err
+		}
+		next.size, next.mod = fi.Size(), fi.ModTime()
+		if prev.valid(next) {
+			return prev, nil
+		}
+		if src, err = os.Open(r.String()); err != nil {
+			return nil, err
+		}
+	case onlineSrc:
+		resp, err := a.get(ctx, r.String(), prev)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusNotModified {
+			next.etag, next.lastMod = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		}
+		if resp.StatusCode == http.StatusNotModified || prev.valid(next) {
+			_ = resp.Body.Close()
+			return prev, nil
+		}
+		src = resp.Body
+	default:
+		if prev != nil {
+			// Inline content never changes.
+			return prev, nil
+		}
+		src = ioutil.NopCloser(bytes.NewReader(r.buf))
+	}
+	defer func() { _ = src.Close() }()
+
+	var (
+		in   io.Reader = src
+		w              = &bytes.Buffer{}
+		orig           = &bytes.Buffer{}
+	)
+	if a.reg.sourceMap && r.kind == onlineSrc {
+		// Keeps the original content for the source map.
+		in = io.TeeReader(src, orig)
+	}
+	if a.reg.license != DefaultLicense {
+		// Sets aside the license comments.
+		buf, err := ioutil.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+		var body []byte
+		if body, next.lic = splitLicenses(a.kind, buf); a.reg.dev {
+			// The comments are kept in place.
+			body = buf
+		}
+		in = bytes.NewReader(body)
+	}
+	if a.reg.dev {
+		_, err = io.Copy(w, in)
+		if err == nil && w.Len() > 0 && !bytes.HasSuffix(w.Bytes(), []byte("\n")) {
+			// Separates the parts.
+			err = w.WriteByte('\n')
+		}
+	} else {
+		err = m.Minify(a.kind, w, in)
+	}
+	if err != nil {
+		return nil, err
+	}
+	next.buf = w.Bytes()
+	if orig.Len() > 0 {
+		next.src = orig.Bytes()
 	}
-	defer func() { _ = file.Close() }()
-	return m.Minify(a.kind, w, file)
+	a.reg.storeCache(key, next)
+
+	return next, nil
+}
+
+// cacheKey returns the key of the minified version of the source in the cache.
+// Besides the source, it depends on the media type of the asset and on the settings
+// used to minify it: the development mode, the license mode and the minifier.
+// The use of a source map is also part of it, as its original content is only kept with it.
+func (a *asset) cacheKey(r *raw) (uint32, error) {
+	key := fmt.Sprintf("%s:%d:%t:%d:%d:%t:", a.kind, r.kind, a.reg.dev, a.reg.license, a.opts, a.reg.sourceMap)
+	return crc32(append([]byte(key), r.buf...))
 }
 
-func (a *asset) minifyURL(r *raw, m *minify.M, w io.Writer) error {
-	resp, err := a.reg.http.Get(r.String())
+// get requests the given URL. With a previous version of its content,
+// it asks to the server to only return it if it has been modified.
+func (a *asset) get(ctx context.Context, url string, prev *cached) (*http.Response, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	if c, ok := a.reg.http.(httpDoer); ok {
+		// The request can be canceled or conditional.
+		var req *http.Request
+		if req, err = http.NewRequest(http.MethodGet, url, nil); err != nil {
+			return nil, err
+		}
+		if prev != nil && prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev != nil && prev.lastMod != "" {
+			req.Header.Set("If-Modified-Since", prev.lastMod)
+		}
+		resp, err = c.Do(req.WithContext(ctx))
+	} else {
+		resp, err = a.reg.http.Get(url)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= http.StatusBadRequest || (prev == nil && resp.StatusCode == http.StatusNotModified) {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	return resp, nil
+}
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		return ErrNotFound
+// remote returns true if one of the parts of the asset is online.
+func (a *asset) remote() bool {
+	a.reg.raw.RLock()
+	defer a.reg.raw.RUnlock()
+
+	for _, key := range a.media {
+		src, ok := a.reg.raw.src[key]
+		if !ok {
+			continue
+		}
+		if src.kind == onlineSrc {
+			return true
+		}
+		for _, alt := range src.alt {
+			if alt.kind == onlineSrc {
+				return true
+			}
+		}
 	}
-	return m.Minify(a.kind, w, resp.Body)
+	return false
 }
 
 // String implements the fmt.Stinger interface.
@@ -237,30 +603,58 @@ func (a *asset) String() string {
 		}
 		hash += "." + fUint32(a.media[i]-min)
 	}
+	return hash + a.optsSuffix() + a.ext()
+}
+
+// ext returns the file extension of the asset.
+func (a *asset) ext() string {
 	if a.kind == JavaScript {
-		return hash + ".js"
+		return ".js"
 	}
-	return hash + ".css"
+	return ".css"
 }
 
 // Tagger must be implemented by an asset to be used in HTML5.
 type Tagger interface {
 	// Link returns the Link HTTP response header to preload the asset.
 	Link(root Dir) string
+	// LinkAttrs returns the Link HTTP response header to preload the asset with these parameters.
+	LinkAttrs(root Dir, attrs ...Attr) string
+	// LinkRel returns the Link HTTP response header to link the asset with this relation.
+	LinkRel(root Dir, rel Rel, attrs ...Attr) string
+	// LinkTag returns the link HTML element to link the asset with this relation.
+	LinkTag(root Dir, rel Rel, attrs ...Attr) string
+	// Origins returns the origins of the remote sources of the asset.
+	Origins() []string
 	// Path returns the relative path to the asset
 	Path(root Dir) string
 	// Tag returns the tag to link to the minified and combined version of the asset.
 	Tag(root Dir) string
+	// AsyncTag returns the tags to load the asset without blocking the rendering.
+	AsyncTag(root Dir, mode AsyncCSS, attrs ...Attr) string
+	// Inline returns the tag with the minified and combined version of the asset inline.
+	Inline(attrs ...Attr) (string, error)
+	// TagAttrs returns the tag to link to the minified and combined version of the asset
+	// with these attributes.
+	TagAttrs(root Dir, attrs ...Attr) string
 	// SrcTags returns all original resources in HTML5 tags.
 	SrcTags(root Dir, stripPrefix ...string) string
+	// SrcTagsAttrs returns all original resources in HTML5 tags with these attributes.
+	SrcTagsAttrs(root Dir, attrs []Attr, stripPrefix ...string) string
+	// SrcHashes returns the hashes of the Content-Security-Policy allowing
+	// the inline blocks rendered by SrcTags.
+	SrcHashes() []string
 }
 
 // Link returns the Link HTTP response header to preload the asset.
 func (a *asset) Link(root Dir) string {
-	if a.kind == JavaScript {
-		return "<" + a.Path(root) + ">; rel=preload; as=script"
-	}
-	return "<" + a.Path(root) + ">; rel=preload; as=style"
+	return a.LinkAttrs(root)
+}
+
+// LinkAttrs returns the Link HTTP response header to preload the asset,
+// followed by the given parameters, like crossorigin.
+func (a *asset) LinkAttrs(root Dir, attrs ...Attr) string {
+	return a.LinkRel(root, Preload, attrs...)
 }
 
 // Path returns the relative path to the asset including the root directory
@@ -281,6 +675,12 @@ func (a *asset) Path(root Dir) string {
 // The list of optional stripPrefix offers means to remove
 // the given prefixes in the asset file path.
 func (a *asset) SrcTags(root Dir, stripPrefix ...string) string {
+	return a.SrcTagsAttrs(root, nil, stripPrefix...)
+}
+
+// SrcTagsAttrs returns all original resources in HTML5 tags with the given attributes.
+// See SrcTags for more details.
+func (a *asset) SrcTagsAttrs(root Dir, attrs []Attr, stripPrefix ...string) string {
 	var (
 		s    string
 		src  *raw
@@ -289,6 +689,10 @@ func (a *asset) SrcTags(root Dir, stripPrefix ...string) string {
 	a.reg.raw.RLock()
 	for _, key := range a.media {
 		src = a.reg.raw.src[key]
+		if src.kind == fallbackSrc {
+			// Development server: only the first source is expected.
+			src = src.alt[0]
+		}
 		s = string(src.buf)
 		if src.kind == fileSrc {
 			// Local link to the resource. We need to manage access
@@ -299,7 +703,14 @@ func (a *asset) SrcTags(root Dir, stripPrefix ...string) string {
 			}
 			s = path.Join("/", s)
 		}
-		tags = append(tags, htmlTag(a.kind, s, src.kind == inlineSrc))
+		if src.kind == inlineSrc {
+			var err error
+			if s, err = inlineText(a.kind, src.buf); err != nil {
+				// Already rejected on addition.
+				continue
+			}
+		}
+		tags = append(tags, htmlTag(a.kind, s, src.kind == inlineSrc, attrs))
 	}
 	a.reg.raw.RUnlock()
 	return strings.Join(tags, "\n")
@@ -316,24 +727,130 @@ func filePathToPath(s string) string {
 
 // Tag returns a HTML5 tag to link to the minified and combined version of the asset.
 func (a *asset) Tag(root Dir) string {
+	return a.TagAttrs(root)
+}
+
+// TagAttrs returns a HTML5 tag to link to the minified and combined version of the asset
+// with the given attributes, like defer or media. Their values are escaped.
+// The src and href attributes are reserved and ignored.
+// With automatic inline rendering, a small asset is rendered inline.
+func (a *asset) TagAttrs(root Dir, attrs ...Attr) string {
+	if text, ok := a.autoInline(); ok {
+		return htmlTag(a.kind, text, true, attrs)
+	}
 	s := a.Path(root)
 	if s == "" {
 		return ""
 	}
-	return htmlTag(a.kind, s, false)
+	return htmlTag(a.kind, s, false, attrs)
+}
+
+var (
+	scriptEnd = regexp.MustCompile(`(?i)<(/?script|!--)`)
+	styleEnd  = regexp.MustCompile(`(?i)</(style)`)
+)
+
+// inlineText returns the content to put inside an inline script or style element.
+// As defined by the HTML specification, the sequences able to end the element
+// or to change the parsing of its content must be escaped: </style in a style,
+// </script, <script and <!-- in a script. See escapeScript for the script.
+// ErrInline is returned if the script can not be escaped safely.
+func inlineText(kind string, buf []byte) (string, error) {
+	if kind != JavaScript {
+		return string(styleEnd.ReplaceAll(buf, []byte(`<\/$1`))), nil
+	}
+	out, err := escapeScript(buf)
+	if err != nil || scriptEnd.Match(out) {
+		return "", ErrInline
+	}
+	return string(out), nil
+}
+
+// escapeScript escapes the sequences able to end a script element or to change
+// the parsing of its content. Inside a string, a template, a regular expression
+// or a comment, </script becomes <\/script and the < of <script or <!-- becomes \x3C.
+// Elsewhere, a space is added after the < operator and the HTML-like comments
+// starting with <!-- become single line comments.
+func escapeScript(buf []byte) ([]byte, error) {
+	var (
+		w  bytes.Buffer
+		lt bool
+	)
+	l := js.NewLexer(bytes.NewReader(buf))
+	for {
+		tt, text := l.Next()
+		switch tt {
+		case js.ErrorToken:
+			return w.Bytes(), lexErr(l.Err())
+		case js.StringToken, js.TemplateToken, js.RegexpToken:
+			escapeScriptText(&w, text)
+		case js.CommentToken:
+			if bytes.HasPrefix(text, []byte("<!--")) {
+				w.WriteString("//")
+				text = text[4:]
+			}
+			escapeScriptText(&w, text)
+		default:
+			if lt && len(text) > 0 && strings.IndexByte("sS/!", text[0]) >= 0 {
+				// Separates the operator of what follows.
+				w.WriteByte(' ')
+			}
+			w.Write(text)
+		}
+		lt = tt == js.PunctuatorToken && bytes.HasSuffix(text, []byte("<"))
+	}
+}
+
+// escapeScriptText escapes the text of a string, a template, a regular expression
+// or a comment, see escapeScript. A < already escaped by a backslash is replaced.
+func escapeScriptText(w *bytes.Buffer, text []byte) {
+	for i := 0; i < len(text); i++ {
+		var esc []byte
+		switch {
+		case text[i] == '<':
+			esc = text[i : i+1]
+		case text[i] == '\\' && i+1 < len(text) && text[i+1] == '<':
+			esc = text[i : i+2]
+		case text[i] == '\\' && i+1 < len(text):
+			// Keeps the escaped character as is.
+			w.Write(text[i : i+2])
+			i++
+			continue
+		default:
+			w.WriteByte(text[i])
+			continue
+		}
+		i += len(esc) - 1
+		switch rest := text[i+1:]; {
+		case hasPrefixFold(rest, "/script"):
+			w.Write(esc)
+			w.WriteString(`\/`)
+			i++
+		case hasPrefixFold(rest, "script"), bytes.HasPrefix(rest, []byte("!--")):
+			w.WriteString(`\x3C`)
+		default:
+			w.Write(esc)
+		}
+	}
+}
+
+// hasPrefixFold tests whether the text begins with prefix, ignoring the case.
+func hasPrefixFold(text []byte, prefix string) bool {
+	return len(text) >= len(prefix) && bytes.EqualFold(text[:len(prefix)], []byte(prefix))
 }
 
-func htmlTag(kind, text string, inline bool) string {
+func htmlTag(kind, text string, inline bool, attrs []Attr) string {
+	at := htmlAttrs(attrs)
 	// Returns a HTML5 JS tag.
 	if kind == JavaScript {
 		if inline {
-			return `<script>` + text + `</script>`
+			return `<script` + at + `>` + text + `</script>`
 		}
-		return `<script src="` + text + `"></script>`
+		return `<script src="` + html.EscapeString(text) + `"` + at + `></script>`
 	}
 	// Returns a HTML5 CSS tag.
 	if inline {
-		return `<style>` + text + `"</style>`
+		return `<style` + at + `>` + text + `</style>`
 	}
-	return `<link rel="stylesheet" href="` + text + `">`
+	return `<link rel="stylesheet" href="` + html.EscapeString(text) + `"` + at + `>`
 }
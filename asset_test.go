@@ -8,8 +8,12 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -79,7 +83,7 @@ func TestAsset_AddString(t *testing.T) {
 
 func TestAsset_AddURL(t *testing.T) {
 	// Creates the registry
-	c := combine.NewBox("", "")
+	c := combine.NewBox("./example/src", "")
 	// Create an asset (any type).
 	css := c.NewCSS()
 	var dt = []struct {
@@ -90,12 +94,80 @@ func TestAsset_AddURL(t *testing.T) {
 		{in: "rv.com/f1.css"},
 		{in: ":", err: errors.New(`parse :: missing protocol scheme`)},
 		{in: "", err: combine.ErrUnexpectedEOF},
+		{in: "data:text/css;base64,LmJsdWV7Y29sb3I6IzAwZjt9"},
+		{in: "data:text/css,.blue%7Bcolor:%2300f%7D"},
+		{in: "data:,"},
+		{in: "data:text/css", err: combine.ErrUnexpectedEOF},
+		{in: "data:text/css;base64,!", err: errors.New(`illegal base64 data at input byte 0`)},
+		{in: "file:///f1.css"},
+		{in: "file:f1.css"},
+		{in: "file:///f33.css", err: errors.New(`stat example/src/f33.css: no such file or directory`)},
+		{in: "file://", err: combine.ErrUnexpectedEOF},
+		{in: "file://localhost/f1.css"},
+		{in: "file://rv.com/f1.css", err: combine.ErrHost},
 	}
 	for i, tt := range dt {
-		if err := css.AddURL(tt.in); err != nil {
-			if err.Error() != tt.err.Error() {
+		err := css.AddURL(tt.in)
+		if err == nil && tt.err != nil {
+			t.Fatalf("%d. expected error: %q", i, tt.err)
+		}
+		if err != nil && err.Error() != tt.err.Error() {
+			t.Fatalf("%d. error mismatch: got=%q, exp=%q", i, err, tt.err)
+		}
+	}
+}
+
+func TestAsset_AddFallback(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&fakeHTTPClient{})
+	// Tests it.
+	var dt = []struct {
+		in  []combine.Source
+		exp []byte
+		err error
+	}{
+		{err: combine.ErrUnexpectedEOF},
+		{in: []combine.Source{combine.StringSource(" ")}, err: combine.ErrUnexpectedEOF},
+		{in: []combine.Source{combine.URLSource("")}, err: combine.ErrUnexpectedEOF},
+		{in: []combine.Source{combine.FileSource("f33.css")}, err: errors.New(`stat example/src/f33.css: no such file or directory`)},
+		{
+			in:  []combine.Source{combine.URLSource("http://www.css.com/f1.css")},
+			exp: []byte(`.red{color:red}`),
+		},
+		{
+			in: []combine.Source{
+				combine.URLSource("http://www.css.com/fail.css"),
+				combine.URLSource("rv.com/f1.css"),
+				combine.FileSource("f1.css"),
+				combine.StringSource(".hide{display:none;}"),
+			},
+			exp: []byte(`.show{display:block}`),
+		},
+		{
+			in: []combine.Source{
+				combine.URLSource("http://www.css.com/fail.css"),
+				combine.StringSource(".hide{display:none;}"),
+			},
+			exp: []byte(`.hide{display:none}`),
+		},
+	}
+	w := &bytes.Buffer{}
+	for i, tt := range dt {
+		css := c.NewCSS()
+		if err := css.AddFallback(tt.in...); err != nil {
+			if tt.err == nil || err.Error() != tt.err.Error() {
 				t.Fatalf("%d. error mismatch: got=%q, exp=%q", i, err, tt.err)
 			}
+			continue
+		}
+		w.Reset()
+		if err := css.Combine(w); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if got := w.Bytes(); !bytes.Equal(got, tt.exp) {
+			t.Errorf("%d. content mismatch: \ngot=%q\nexp=%q", i, got, tt.exp)
 		}
 	}
 }
@@ -137,6 +209,11 @@ window.onload=hey;document.location="/home.html";`),
 			urlPath: []string{"http://www.css.com/fail.css"},
 			err:     combine.ErrNotFound,
 		},
+		{
+			file:    c.NewCSS(),
+			urlPath: []string{"data:text/css;base64,LmJsdWV7Y29sb3I6IzAwZjt9", "file:///f1.css"},
+			exp:     []byte(`.blue{color:#00f}.show{display:block}`),
+		},
 	}
 	w := &bytes.Buffer{}
 	for i, tt := range dt {
@@ -164,6 +241,173 @@ window.onload=hey;document.location="/home.html";`),
 	}
 }
 
+func TestAsset_Combine_Cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combine")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	name := filepath.Join(dir, "f.css")
+	if err = ioutil.WriteFile(name, []byte(".a{color:red}"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Creates the registry
+	hc := &etagHTTPClient{}
+	c := combine.NewBox(combine.Dir(dir), "")
+	c.UseHTTPClient(hc)
+
+	combineCSS := func() string {
+		css := c.NewCSS()
+		if err := css.AddURL("http://www.css.com/f.css"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := css.AddFile("f.css"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		w := &bytes.Buffer{}
+		if err := css.Combine(w); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return w.String()
+	}
+	exp := ".e1{color:red}.a{color:red}"
+	if out := combineCSS(); out != exp {
+		t.Fatalf("mismatch content: got:%q exp:%q", out, exp)
+	}
+	// Unchanged sources: the remote one is not downloaded again.
+	if out := combineCSS(); out != exp {
+		t.Fatalf("mismatch content: got:%q exp:%q", out, exp)
+	}
+	if hc.sent != 1 {
+		t.Errorf("mismatch number of downloads: got:%d exp:%d", hc.sent, 1)
+	}
+	// Updated sources.
+	hc.version = 2
+	if err = ioutil.WriteFile(name, []byte(".ab{color:red}"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp = ".e2{color:red}.ab{color:red}"
+	if out := combineCSS(); out != exp {
+		t.Fatalf("mismatch content: got:%q exp:%q", out, exp)
+	}
+}
+
+// Builds a fake http client which supports the ETag validator.
+type etagHTTPClient struct {
+	version, sent int
+}
+
+// Get mocks the method of same name of the http package.
+func (c *etagHTTPClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do mocks the method of same name of the http package.
+func (c *etagHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if c.version == 0 {
+		c.version = 1
+	}
+	w := httptest.NewRecorder()
+	etag := `"` + strconv.Itoa(c.version) + `"`
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return w.Result(), nil
+	}
+	c.sent++
+	_, _ = io.WriteString(w, ".e"+strconv.Itoa(c.version)+"{color:red}")
+	return w.Result(), nil
+}
+
+func TestAsset_Combine_SourceError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combine")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	name := filepath.Join(dir, "f.css")
+	if err = ioutil.WriteFile(name, []byte(".a{color:red}"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Creates the registry
+	c := combine.NewBox(combine.Dir(dir), "")
+	c.UseHTTPClient(&fakeHTTPClient{})
+
+	var dt = []struct {
+		in   func(f combine.File) error
+		kind string
+		src  string
+		is   func(err error) bool
+		line,
+		column int
+	}{
+		{
+			in: func(f combine.File) error {
+				return f.AddURL("http://www.css.com/fail.css")
+			},
+			kind: "url",
+			src:  "http://www.css.com/fail.css",
+			is: func(err error) bool {
+				return err == combine.ErrNotFound
+			},
+		},
+		{
+			in: func(f combine.File) error {
+				if err := f.AddFile("f.css"); err != nil {
+					return err
+				}
+				return os.Remove(name)
+			},
+			kind: "file",
+			src:  name,
+			is:   os.IsNotExist,
+		},
+		{
+			in: func(f combine.File) error {
+				return f.AddString("var a = 1 ;")
+			},
+			kind:   "inline",
+			src:    "inline",
+			line:   1,
+			column: 12,
+		},
+	}
+	for i, tt := range dt {
+		css := c.NewCSS()
+		if err = css.AddString(".b{color:red}"); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if err = tt.in(css); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		err = css.Combine(ioutil.Discard)
+		e, ok := err.(*combine.SourceError)
+		if !ok {
+			t.Fatalf("%d. unexpected error: %v", i, err)
+		}
+		if e.Kind != tt.kind || e.Source != tt.src || e.Index != 1 {
+			t.Errorf("%d. mismatch source: got:%+v", i, e)
+		}
+		if e.Line != tt.line || e.Column != tt.column {
+			t.Errorf("%d. mismatch position: got:%d:%d exp:%d:%d", i, e.Line, e.Column, tt.line, tt.column)
+		}
+		if tt.is != nil && !tt.is(e.Err) {
+			t.Errorf("%d. mismatch error: got:%v", i, e.Err)
+		}
+		if !e.Is(combine.ErrNotFound) {
+			t.Errorf("%d. expected not found error: got:%v", i, err)
+		}
+		// The cause is kept for compatibility.
+		if e.Cause() != combine.ErrNotFound {
+			t.Errorf("%d. mismatch cause: got:%v exp:%v", i, e.Cause(), combine.ErrNotFound)
+		}
+	}
+}
+
 var errNoTransport = errors.New("no transport")
 
 // Builds a fake http client by mocking main methods.
@@ -259,3 +503,186 @@ func TestAsset_Link(t *testing.T) {
 		t.Errorf("mismatch content: got:%q exp:%q", out, exp)
 	}
 }
+
+func TestAsset_TagAttrs(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "")
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddString("var a = 56;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddString(".black{color:#000;}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		in    combine.File
+		attrs []combine.Attr
+		out   string
+	}{
+		{in: c.NewCSS(), attrs: []combine.Attr{{Key: "media", Val: "print"}}},
+		{in: js, out: `<script src="/2925958264.0.js"></script>`},
+		{
+			in:    js,
+			attrs: []combine.Attr{{Key: "defer"}, {Key: "type", Val: "module"}, {Key: "crossorigin", Val: "anonymous"}},
+			out:   `<script src="/2925958264.0.js" defer type="module" crossorigin="anonymous"></script>`,
+		},
+		{
+			in:    js,
+			attrs: []combine.Attr{{Key: "src", Val: "/evil.js"}, {Key: `id" onload="x`}, {Key: "id", Val: `a"><b>&`}},
+			out:   `<script src="/2925958264.0.js" id="a&#34;&gt;&lt;b&gt;&amp;"></script>`,
+		},
+		{
+			in:    js,
+			attrs: []combine.Attr{{Key: "OnLoad", Val: "alert(1)"}, {Key: "style", Val: "x"}, {Key: "srcdoc", Val: "x"}, {Key: "async"}},
+			out:   `<script src="/2925958264.0.js" async></script>`,
+		},
+		{
+			in:    css,
+			attrs: []combine.Attr{{Key: "media", Val: "print"}, {Key: "referrerpolicy", Val: "no-referrer"}},
+			out:   `<link rel="stylesheet" href="/3236089261.0.css" media="print" referrerpolicy="no-referrer">`,
+		},
+	}
+	for i, tt := range dt {
+		if out := tt.in.TagAttrs("", tt.attrs...); out != tt.out {
+			t.Errorf("%d. tag mismatch: got=%q, exp=%q", i, out, tt.out)
+		}
+	}
+}
+
+func TestAsset_SrcTagsAttrs(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := js.AddURL("http://www.js.com/f1.js?a=1&b=2"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := js.AddString("var a = 56;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp := `<script src="/f1.js" async></script>
+<script src="http://www.js.com/f1.js?a=1&amp;b=2" async></script>
+<script async>var a = 56;</script>`
+	if out := js.SrcTagsAttrs("/", []combine.Attr{{Key: "async"}}, "example/src"); out != exp {
+		t.Errorf("mismatch content: got:%q exp:%q", out, exp)
+	}
+}
+
+func TestAsset_LinkAttrs(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		attrs []combine.Attr
+		out   string
+	}{
+		{out: "</static/444270761.0.css>; rel=preload; as=style"},
+		{
+			attrs: []combine.Attr{{Key: "crossorigin"}, {Key: "media", Val: "screen and (min-width: 600px)"}, {Key: "type", Val: "text/css"}},
+			out:   `</static/444270761.0.css>; rel=preload; as=style; crossorigin; media="screen and (min-width: 600px)"; type="text/css"`,
+		},
+		{
+			attrs: []combine.Attr{{Key: "href", Val: "/x"}, {Key: "title", Val: `a"b`}},
+			out:   `</static/444270761.0.css>; rel=preload; as=style; title="a\"b"`,
+		},
+	}
+	for i, tt := range dt {
+		if out := css.LinkAttrs("/static/", tt.attrs...); out != tt.out {
+			t.Errorf("%d. link mismatch: got=%q, exp=%q", i, out, tt.out)
+		}
+	}
+}
+
+func TestAsset_SrcTags_Escape(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "")
+
+	var dt = []struct {
+		mediaType, in, out string
+	}{
+		{mediaType: combine.JavaScript, in: `var a = "b";`, out: `<script>var a = "b";</script>`},
+		{
+			mediaType: combine.JavaScript,
+			in:        `var a = "</script><script>alert(1)</SCRIPT>";`,
+			out:       `<script>var a = "<\/script>\x3Cscript>alert(1)<\/SCRIPT>";</script>`,
+		},
+		{mediaType: combine.JavaScript, in: `var a = "<!--";`, out: `<script>var a = "\x3C!--";</script>`},
+		{mediaType: combine.JavaScript, in: `var a = "\<script";`, out: `<script>var a = "\x3Cscript";</script>`},
+		{mediaType: combine.JavaScript, in: `var r = /<script>/i;`, out: `<script>var r = /\x3Cscript>/i;</script>`},
+		{
+			mediaType: combine.JavaScript,
+			in:        "var t = `</script>${a}<!--`;",
+			out:       "<script>var t = `<\\/script>${a}\\x3C!--`;</script>",
+		},
+		{mediaType: combine.JavaScript, in: `if (a<script.length) {}`, out: `<script>if (a< script.length) {}</script>`},
+		{mediaType: combine.JavaScript, in: "<!-- comment\nvar a = 1;", out: "<script>// comment\nvar a = 1;</script>"},
+		{mediaType: combine.JavaScript, in: `/* </script> */ var a;`, out: `<script>/* <\/script> */ var a;</script>`},
+		{mediaType: combine.CSS, in: `.a{color:red}`, out: `<style>.a{color:red}</style>`},
+		{
+			mediaType: combine.CSS,
+			in:        `.a::after{content:"</style><script>alert(1)</script></Style>"}`,
+			out:       `<style>.a::after{content:"<\/style><script>alert(1)</script><\/Style>"}</style>`,
+		},
+	}
+	for i, tt := range dt {
+		f := c.NewCSS()
+		if tt.mediaType == combine.JavaScript {
+			f = c.NewJS()
+		}
+		if err := f.AddString(tt.in); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if out := f.SrcTags("/"); out != tt.out {
+			t.Errorf("%d. tag mismatch: got=%q, exp=%q", i, out, tt.out)
+		}
+		// The hash is the one of the escaped content.
+		text := strings.TrimSuffix(tt.out[strings.Index(tt.out, ">")+1:], "</script>")
+		text = strings.TrimSuffix(text, "</style>")
+		if h := f.SrcHashes(); len(h) != 1 || h[0] != combine.Hash(text) {
+			t.Errorf("%d. hash mismatch: got=%q, exp=%q", i, h, combine.Hash(text))
+		}
+	}
+}
+
+func TestAsset_Combine_CacheKey(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "")
+
+	combined := func(f combine.File, in string) string {
+		if err := f.AddString(in); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		w := &bytes.Buffer{}
+		if err := f.Combine(w); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return w.String()
+	}
+	// The same source minified as JavaScript and as CSS.
+	const rule = "a { color : red ; }"
+	if js, css := combined(c.NewJS(), rule), combined(c.NewCSS(), rule); js == css {
+		t.Errorf("expected distinct versions: got:%q", js)
+	}
+	// The same source with an other license mode.
+	const lic = "/*! MIT */.b{color:blue}"
+	_ = combined(c.NewCSS(), lic)
+	c.UseLicense(combine.KeepLicense)
+	if out := combined(c.NewCSS(), lic); !strings.HasPrefix(out, "/*! MIT */\n") {
+		t.Errorf("expected inline license: got:%q", out)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"html"
+	"strings"
+)
+
+// Attr is an attribute of a HTML tag or a parameter of a Link HTTP header.
+// Without value, the attribute is a boolean one, like async or defer.
+type Attr struct {
+	Key, Val string
+}
+
+// validKey returns true if the name of the attribute can be rendered as is.
+// The attributes carrying the link to the asset are reserved and the ones
+// able to run a script, like the event handlers, are rejected.
+func (a Attr) validKey() bool {
+	k := strings.ToLower(a.Key)
+	switch k {
+	case "", "src", "href", "xlink:href", "style", "srcdoc", "action", "formaction":
+		return false
+	}
+	if strings.HasPrefix(k, "on") {
+		return false
+	}
+	return strings.IndexFunc(a.Key, func(r rune) bool {
+		return r <= ' ' || r == 0x7f || strings.ContainsRune("\"'<>/=;,\\", r)
+	}) < 0
+}
+
+// html returns the attribute with its escaped value, preceded by a space.
+func (a Attr) html() string {
+	if !a.validKey() {
+		return ""
+	}
+	if a.Val == "" {
+		return " " + a.Key
+	}
+	return " " + a.Key + `="` + html.EscapeString(a.Val) + `"`
+}
+
+// param returns the attribute as a parameter of a Link HTTP header.
+// The value is quoted if it is not a token.
+func (a Attr) param() string {
+	if !a.validKey() {
+		return ""
+	}
+	if a.Val == "" {
+		return "; " + a.Key
+	}
+	if strings.IndexFunc(a.Val, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r)
+	}) < 0 {
+		return "; " + a.Key + "=" + a.Val
+	}
+	v := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a.Val)
+	return "; " + a.Key + `="` + v + `"`
+}
+
+// htmlAttrs returns the list of attributes to add in a HTML tag.
+func htmlAttrs(attrs []Attr) string {
+	var s string
+	for _, a := range attrs {
+		s += a.html()
+	}
+	return s
+}
+
+// linkParams returns the list of parameters to add in a Link HTTP header.
+func linkParams(attrs []Attr) string {
+	var s string
+	for _, a := range attrs {
+		s += a.param()
+	}
+	return s
+}
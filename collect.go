@@ -0,0 +1,190 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Collector records the assets used to render a page, in the order of their
+// first use and without duplicate. The first ones are expected to be
+// the dependencies of the next ones.
+// It's safe for concurrent use.
+type Collector struct {
+	root  Dir
+	files []File
+	seen  map[string]struct{}
+	mu    sync.Mutex
+}
+
+// NewCollector returns a new instance of Collector.
+// The root directory is the one used to link the assets.
+func NewCollector(root Dir) *Collector {
+	return &Collector{
+		root: root,
+		seen: make(map[string]struct{}),
+	}
+}
+
+// Add records the assets. The empty or already recorded ones are ignored.
+func (c *Collector) Add(files ...File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		name := f.String()
+		if name == "" {
+			continue
+		}
+		if _, ok := c.seen[name]; ok {
+			continue
+		}
+		c.seen[name] = struct{}{}
+		c.files = append(c.files, f)
+	}
+}
+
+// Files returns the recorded assets in order.
+func (c *Collector) Files() []File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]File(nil), c.files...)
+}
+
+// Links returns the values of the Link HTTP header to preload the recorded assets,
+// with the given parameters. The assets rendered inline by Tag are ignored.
+func (c *Collector) Links(attrs ...Attr) []string {
+	var links []string
+	for _, f := range c.Files() {
+		if a, ok := f.(*asset); ok {
+			if _, inline := a.autoInline(); inline {
+				continue
+			}
+		}
+		links = append(links, f.LinkAttrs(c.root, attrs...))
+	}
+	return links
+}
+
+// Tags returns the tags of the recorded assets to add in the head of the page,
+// the style sheets first, then the scripts, each in order, with the given attributes.
+func (c *Collector) Tags(attrs ...Attr) string {
+	var css, js []string
+	for _, f := range c.Files() {
+		if a, ok := f.(*asset); ok && a.kind == JavaScript {
+			js = append(js, f.TagAttrs(c.root, attrs...))
+		} else {
+			css = append(css, f.TagAttrs(c.root, attrs...))
+		}
+	}
+	return strings.Join(append(css, js...), "\n")
+}
+
+// collectorKey is the key of the collector in a context.
+type collectorKey struct{}
+
+// WithCollector returns a copy of the parent context carrying this collector.
+func WithCollector(parent context.Context, c *Collector) context.Context {
+	return context.WithValue(parent, collectorKey{}, c)
+}
+
+// CollectorFromContext returns the collector stored in the context, if any.
+func CollectorFromContext(ctx context.Context) (c *Collector, ok bool) {
+	c, ok = ctx.Value(collectorKey{}).(*Collector)
+	return
+}
+
+// Collect records the assets in the collector of the context.
+// Without collector, it does nothing.
+func Collect(ctx context.Context, files ...File) {
+	if c, ok := CollectorFromContext(ctx); ok {
+		c.Add(files...)
+	}
+}
+
+// CollectHandler returns a middleware storing a new collector in the context
+// of each request, see Collect. The root directory is the one used to link the assets.
+// The response is buffered to add a Link header preloading all the assets recorded
+// by the handler. A flush sends it early, then the assets recorded after are ignored.
+func CollectHandler(root Dir, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := NewCollector(root)
+		cw := &collectWriter{ResponseWriter: w, before: func() {
+			if links := c.Links(); len(links) > 0 {
+				w.Header().Add("Link", strings.Join(links, ", "))
+			}
+		}}
+		next.ServeHTTP(cw, r.WithContext(WithCollector(r.Context(), c)))
+		_ = cw.finish()
+	})
+}
+
+// collectWriter buffers the response until its end or its first flush,
+// then calls before once, just before sending its headers,
+// to deal with the collected assets.
+type collectWriter struct {
+	http.ResponseWriter
+	before func()
+	code   int
+	buf    bytes.Buffer
+	sent   bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *collectWriter) WriteHeader(code int) {
+	if w.sent {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *collectWriter) Write(p []byte) (int, error) {
+	if w.sent {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+// Flush implements the http.Flusher interface.
+func (w *collectWriter) Flush() {
+	if err := w.finish(); err != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Push implements the http.Pusher interface.
+func (w *collectWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// finish sends the headers and the buffered content of the response, if not already done.
+func (w *collectWriter) finish() error {
+	if w.sent {
+		return nil
+	}
+	w.sent = true
+	w.before()
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	_, err := w.buf.WriteTo(w.ResponseWriter)
+	return err
+}
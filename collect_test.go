@@ -0,0 +1,109 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestCollectHandler(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js", "f2.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	late := c.NewJS()
+	if err := late.AddFile("f2.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var head string
+	h := combine.CollectHandler("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Partials.
+		combine.Collect(r.Context(), js)
+		combine.Collect(r.Context(), css, js, c.NewCSS())
+		coll, ok := combine.CollectorFromContext(r.Context())
+		if !ok {
+			t.Fatal("expected collector")
+		}
+		head = coll.Tags()
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, "<!doctype html>")
+		// Collected after the first write, but still preloaded.
+		combine.Collect(r.Context(), late)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	exp := "</static/883963153.0.1831620815.js>; rel=preload; as=script, " +
+		"</static/444270761.0.css>; rel=preload; as=style, " +
+		"</static/" + late.String() + ">; rel=preload; as=script"
+	if out := w.Header().Get("Link"); out != exp {
+		t.Errorf("mismatch link: got=%q, exp=%q", out, exp)
+	}
+	if w.Code != http.StatusNotFound || w.Body.String() != "<!doctype html>" {
+		t.Errorf("mismatch response: got=%d %q", w.Code, w.Body.String())
+	}
+	exp = `<link rel="stylesheet" href="/static/444270761.0.css">
+<script src="/static/883963153.0.1831620815.js"></script>`
+	if head != exp {
+		t.Errorf("mismatch head: got=%q, exp=%q", head, exp)
+	}
+	// Without collector, nothing is recorded.
+	ctx := context.Background()
+	combine.Collect(ctx, js)
+	if _, ok := combine.CollectorFromContext(ctx); ok {
+		t.Error("unexpected collector")
+	}
+}
+
+func TestCollectHandler_Flush(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	js := c.NewJS()
+	if err := js.AddFile("f1.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := combine.CollectHandler("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		combine.Collect(r.Context(), css)
+		_, _ = io.WriteString(w, "<!doctype html>")
+		w.(http.Flusher).Flush()
+		// Too late to be preloaded: the headers are sent.
+		combine.Collect(r.Context(), js)
+		_, _ = io.WriteString(w, "<html>")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	exp := "</static/444270761.0.css>; rel=preload; as=style"
+	if out := w.Header().Get("Link"); out != exp {
+		t.Errorf("mismatch link: got=%q, exp=%q", out, exp)
+	}
+	if !w.Flushed || w.Body.String() != "<!doctype html><html>" {
+		t.Errorf("mismatch response: got=%q", w.Body.String())
+	}
+}
@@ -8,18 +8,25 @@
 package combine
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tdewolff/minify"
 )
 
 // List of available MIME types
@@ -40,8 +47,103 @@ var (
 	ErrMime = errors.New("unknown mime type")
 	// ErrNotFound is returned ii the asset is not found.
 	ErrNotFound = errors.New("not found")
+	// ErrBusy is returned if the build of the asset can not start in time.
+	ErrBusy = errors.New("too many builds in progress")
+	// ErrMinifier is returned if the settings of the minifier are unknown, see Keyer.
+	ErrMinifier = errors.New("unknown minifier settings")
+	// ErrHost is returned if a file URL names a remote host.
+	ErrHost = errors.New("file URL on a remote host")
+	// ErrInline is returned if a script can not be rendered inline safely.
+	ErrInline = errors.New("script can not be escaped to be inline")
 )
 
+// BuildError records the failure of the build of an asset.
+type BuildError struct {
+	// Name is the name of the asset.
+	Name string
+	// Err is the cause of the failure.
+	Err error
+	// Retry is the time before which no new build is attempted.
+	// It's the zero time without back-off.
+	Retry time.Time
+}
+
+// Error implements the error interface.
+func (e *BuildError) Error() string {
+	return "build " + e.Name + ": " + e.Err.Error()
+}
+
+// Cause returns the cause of the failure.
+func (e *BuildError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the cause of the failure.
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// SourceError records the failure to get or to minify one part of an asset.
+type SourceError struct {
+	// Kind is the kind of source: file, inline or url.
+	Kind string
+	// Source is the file path or the URL of the source.
+	Source string
+	// Index is the position of the part in the asset.
+	Index int
+	// Err is the cause of the failure.
+	Err error
+	// Line and Column locate the syntax error in the source, if known.
+	Line, Column int
+}
+
+func newSourceError(index int, r *raw, err error) *SourceError {
+	e := &SourceError{Index: index, Err: err}
+	if r != nil {
+		e.Kind, e.Source = r.kindName(), r.origin()
+	}
+	if pe, ok := err.(interface {
+		Position() (int, int, string)
+	}); ok {
+		// Parse error of the minifier.
+		e.Line, e.Column, _ = pe.Position()
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e *SourceError) Error() string {
+	s := "part " + strconv.Itoa(e.Index)
+	if e.Kind != "" {
+		s += ", " + e.Kind
+	}
+	if e.Kind != "inline" && e.Source != "" {
+		s += " " + e.Source
+	}
+	if e.Line > 0 {
+		s += ":" + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column)
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Cause returns ErrNotFound for compatibility with errors.Cause:
+// it was the error returned whatever the failure on a source.
+// The underlying failure is kept in Err, see Unwrap.
+func (e *SourceError) Cause() error {
+	return ErrNotFound
+}
+
+// Unwrap returns the cause of the failure.
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true with ErrNotFound for compatibility:
+// it was the error returned whatever the failure on a source.
+func (e *SourceError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
 // Dir defines the current workspace.
 // An empty Dir is treated as ".".
 type Dir string
@@ -60,9 +162,23 @@ func (d Dir) String() string {
 type Box struct {
 	raw          *rawMap
 	min          *minMap
+	cache        *cacheMap
+	opts         *optsMap
+	queue        *buildQueue
 	src, dst     Dir
 	http         HTTPGetter
 	buildVersion string
+	ttl          time.Duration
+	fetchLimit   int
+	inlineLimit  int64
+	warmLimit    int
+	backoff      time.Duration
+	onError      Hook
+	onStale      Hook
+	license      License
+	sourceMap    bool
+	sourceRoot   string
+	dev          bool
 }
 
 type minMap struct {
@@ -75,15 +191,25 @@ type rawMap struct {
 	sync.RWMutex
 }
 
+type cacheMap struct {
+	src map[uint32]*cached
+	sync.RWMutex
+}
+
 // NewBox returns a new instance of Box.
 func NewBox(src, dst Dir) *Box {
 	return &Box{
 		raw:          &rawMap{src: make(map[uint32]*raw)},
 		min:          &minMap{src: make(map[uint32]*Static)},
+		cache:        &cacheMap{src: make(map[uint32]*cached)},
+		opts:         &optsMap{src: make(map[uint32]minify.Minifier), def: make(map[string]uint32)},
+		queue:        &buildQueue{},
 		src:          src,
 		dst:          dst,
 		http:         newHTTPClient(),
 		buildVersion: strconv.FormatInt(time.Now().Unix(), 10),
+		fetchLimit:   defaultFetchLimit,
+		warmLimit:    runtime.NumCPU(),
 	}
 }
 
@@ -98,50 +224,276 @@ func (b *Box) Close() (err error) {
 			if err = os.Remove(name); err != nil {
 				return err
 			}
+			for _, ext := range companionExts {
+				if err = os.Remove(name + ext); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
 		}
 	}
-	return
+	return nil
+}
+
+// writeFile atomically writes the content of the given writer to the named file.
+func writeFile(name string, src io.WriterTo) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = src.WriteTo(f)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
 }
 
 // Open implements the http.FileSystem.
+// As the http.FileServer only knows the errors of the file system,
+// a build failing with ErrBusy is reported as a permission error, so
+// a 403 Forbidden status code. Use the Box as handler to reply with
+// a 503 Service Unavailable status code instead, see Box.ServeHTTP.
 func (b *Box) Open(name string) (http.File, error) {
+	name, ext := companion(name)
+	if !b.hasCompanion(ext) {
+		return nil, os.ErrNotExist
+	}
 	// Transforms the file name to an asset
-	a, err := b.ToAsset(basename(name))
+	a, err := b.toAsset(basename(name))
 	if err != nil {
 		return nil, os.ErrNotExist
 	}
+	d, err := b.static(a)
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+	return os.Open(d.Link + ext)
+}
+
+// List of extensions of the files built with the static version of an asset.
+const mapExt = ".map"
+
+var companionExts = []string{mapExt, licenseExt}
+
+// companion splits the name of a companion file of an asset
+// in the name of the asset and the extension of the companion.
+// The extension is empty if the name is not a companion.
+func companion(name string) (string, string) {
+	for _, ext := range companionExts {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), ext
+		}
+	}
+	return name, ""
+}
+
+// hasCompanion returns true if this extension of companion is built by the box.
+func (b *Box) hasCompanion(ext string) bool {
+	switch ext {
+	case "":
+		return true
+	case mapExt:
+		return b.sourceMap
+	case licenseExt:
+		return b.license == ExtractLicense
+	}
+	return false
+}
+
+// static returns the static version of the asset.
+// It is created on the first demand.
+func (b *Box) static(a *asset) (*Static, error) {
+	return b.stream(a, nil)
+}
+
+// stream returns the static version of the asset like static.
+// If the asset has to be built, its content is also written to w, if not nil,
+// while the static file is created.
+func (b *Box) stream(a *asset, w io.Writer) (*Static, error) {
 	// Tries to retrieve it if exists.
-	d, found := b.LoadOrStore(a, &Static{})
+	d := &Static{}
+	d.Add(1)
+	cur, found := b.LoadOrStore(a, d)
 	if found {
-		return os.Open(d.Link)
+		if cur.err == nil {
+			b.refresh(a, cur)
+			return cur, nil
+		}
+		e, ok := cur.err.(*BuildError)
+		if !ok || time.Now().Before(e.Retry) || !b.swap(a, cur, d) {
+			// Failed to build it, recently or by an other demand.
+			return nil, cur.err
+		}
 	}
 	// Create a local static version of the asset.
-	err = b.append(filepath.Join(b.dst.String(), a.String()), a, d)
+	err := b.append(filepath.Join(b.dst.String(), a.String()), a, d, w)
 	if err != nil {
-		return nil, os.ErrPermission
+		return nil, err
 	}
-	return os.Open(d.Link)
+	return d, nil
 }
 
-func (b *Box) append(name string, src StringCombiner, dst *Static) (err error) {
+func (b *Box) append(name string, src *asset, dst *Static, w io.Writer) (err error) {
 	defer dst.Done()
-	dst.Add(1)
 
-	createFile := func(a StringCombiner, name string) error {
-		f, err := os.Create(name)
-		if err != nil {
+	if err = b.build(name, src, nil, dst, w); err == nil {
+		return
+	}
+	if err != ErrBusy {
+		e := &BuildError{Name: src.String(), Err: err}
+		if b.backoff > 0 {
+			e.Retry = time.Now().Add(b.backoff)
+		}
+		if b.onError != nil {
+			b.onError(e.Name, e.Err)
+		}
+		err = e
+	}
+	// Shares the failure with the demands waiting for it.
+	dst.err = err
+	if e, ok := err.(*BuildError); ok && !e.Retry.IsZero() {
+		// Remembers it to avoid a new attempt before the end of the back-off.
+		return
+	}
+	b.Delete(src)
+	return
+}
+
+// build combines the asset in a temporary file, then replaces the static file by it
+// if the content has changed since the previous version.
+// If w is not nil, the content is also written to it.
+func (b *Box) build(name string, src *asset, prev, dst *Static, w io.Writer) error {
+	if err := b.queue.acquire(); err != nil {
+		return err
+	}
+	defer b.queue.release()
+
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	h := fnv.New32()
+	ws := []io.Writer{f, h}
+	if w != nil {
+		ws = append(ws, w)
+	}
+	var (
+		sm  *sourceMap
+		lic *bytes.Buffer
+	)
+	if b.sourceMap {
+		sm = newSourceMap(filepath.Base(name), b.dev)
+	}
+	if b.license == ExtractLicense {
+		lic = &bytes.Buffer{}
+	}
+	fallbacks, err := src.combine(io.MultiWriter(ws...), sm, lic)
+	if err == nil {
+		// The trailing comments are not part of the content rendered inline.
+		dst.body, err = f.Seek(0, io.SeekCurrent)
+	}
+	if err == nil && lic != nil && lic.Len() > 0 {
+		_, err = io.WriteString(io.MultiWriter(ws...), licenseComment(name))
+	}
+	if err == nil && sm != nil {
+		_, err = io.WriteString(io.MultiWriter(ws...), sm.comment(src.kind))
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	dst.sum = h.Sum32()
+	if prev == nil || prev.sum != dst.sum {
+		if sm != nil {
+			if err = writeFile(name+mapExt, sm); err != nil {
+				return err
+			}
+		}
+		if lic != nil {
+			if lic.Len() > 0 {
+				err = writeFile(name+licenseExt, lic)
+			} else if err = os.Remove(name + licenseExt); os.IsNotExist(err) {
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err = os.Rename(f.Name(), name); err != nil {
 			return err
 		}
-		defer func() { _ = f.Close() }()
+	}
+	if dst.body < b.inlineLimit {
+		// Keeps the small ones to render them inline.
+		if dst.inline, err = readBody(name, dst.body); err != nil {
+			return err
+		}
+	}
+	dst.Link = name
+	dst.Fallbacks = fallbacks
+	dst.built = time.Now()
+	dst.remote = src.remote()
+	return nil
+}
 
-		return a.Combine(f)
+// refresh rebuilds in background the static of an asset with remote sources
+// once its time to live has expired. Meanwhile, the previous version is served.
+func (b *Box) refresh(src *asset, prev *Static) {
+	if !prev.expired(b.ttl) {
+		return
 	}
-	if err = createFile(src, name); err != nil {
-		b.Delete(src)
-	} else {
-		dst.Link = name
+	if !atomic.CompareAndSwapInt32(&prev.refreshing, 0, 1) {
+		// Already in progress.
+		return
 	}
-	return
+	go func() {
+		if err := b.rebuild(src, prev); err != nil {
+			// Keeps serving the previous version until the next attempt.
+			b.swap(src, prev, prev.postpone(b.ttl, b.backoff))
+		}
+	}()
+}
+
+// rebuild builds a new version of the static. On failure, the previous version
+// is kept to be served until a successful rebuild replaces it.
+func (b *Box) rebuild(src *asset, prev *Static) error {
+	dst := &Static{}
+	if err := b.build(prev.Link, src, prev, dst, nil); err != nil {
+		if b.onStale != nil {
+			b.onStale(src.String(), err)
+		}
+		return err
+	}
+	b.Store(src, dst)
+	return nil
+}
+
+// Rebuild builds again the static version of the asset, to take care of
+// the changes of its sources. If it fails, the previous version of the asset,
+// if any, is still served and the stale hook is called, see UseStaleHook.
+func (b *Box) Rebuild(f File) error {
+	a, err := b.toAsset(basename(f.String()))
+	if err != nil {
+		return err
+	}
+	if d, ok := b.Load(a); ok {
+		d.Wait()
+		if d.err == nil {
+			return b.rebuild(a, d)
+		}
+		// No version to keep.
+		b.Delete(a)
+	}
+	_, err = b.static(a)
+	return err
 }
 
 func basename(name string) (mediaType, hash string) {
@@ -177,13 +529,26 @@ func (b *Box) NewJS() File {
 // ToAsset transforms a hash with its media type to a CSS or JS asset.
 // If it fails, an error is returned instead.
 func (b *Box) ToAsset(mediaType, hash string) (File, error) {
+	a, err := b.toAsset(mediaType, hash)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (b *Box) toAsset(mediaType, hash string) (*asset, error) {
 	// Initialization by king of media
 	a, ext, err := b.newAsset(mediaType)
 	if err != nil {
 		return nil, err
 	}
+	// Minifier settings
+	hash, a.opts, err = b.splitOpts(toHash(hash, ext))
+	if err != nil {
+		return nil, err
+	}
 	// Checksum
-	keys := strings.Split(toHash(hash, ext), ".")
+	keys := strings.Split(hash, ".")
 	if len(keys)-1 < 1 {
 		return nil, ErrUnexpectedEOF
 	}
@@ -217,14 +582,166 @@ func (b *Box) newAsset(mediaType string) (a *asset, ext string, err error) {
 	if err != nil {
 		return
 	}
+	b.opts.RLock()
 	a = &asset{
 		kind:  mediaType,
 		media: make([]uint32, 0),
+		opts:  b.opts.def[mediaType],
 		reg:   b,
 	}
+	b.opts.RUnlock()
 	return
 }
 
+// Default number of sources of an asset to fetch concurrently.
+const defaultFetchLimit = 4
+
+// UseFetchLimit defines the maximum number of sources of an asset
+// to fetch and minify concurrently. The combined content keeps its order.
+// By default, 4 sources are treated at the same time.
+func (b *Box) UseFetchLimit(n int) *Box {
+	if n < 1 {
+		n = 1
+	}
+	b.fetchLimit = n
+	return b
+}
+
+// UseBuildLimit defines the maximum number of assets to build at the same time.
+// The other builds are queued until the timeout, if positive, is reached.
+// Then they fail with ErrBusy and the Box.ServeHTTP method replies with
+// a 503 Service Unavailable status code. Only this method honors it:
+// behind a http.FileServer, the request fails with a 403 Forbidden status code.
+// By default, the builds are not limited.
+func (b *Box) UseBuildLimit(n int, timeout time.Duration) *Box {
+	q := &buildQueue{timeout: timeout}
+	if n > 0 {
+		q.slots = make(chan struct{}, n)
+	}
+	b.queue = q
+	return b
+}
+
+// Stats represents the activity of the builds of the box.
+type Stats struct {
+	// Queued is the number of builds waiting to start.
+	Queued int64
+	// Building is the number of builds in progress.
+	Building int64
+	// Rejected is the number of builds abandoned after the queue timeout.
+	Rejected uint64
+}
+
+// Stats returns the current activity of the builds of the box.
+func (b *Box) Stats() Stats {
+	return Stats{
+		Queued:   atomic.LoadInt64(&b.queue.queued),
+		Building: atomic.LoadInt64(&b.queue.building),
+		Rejected: atomic.LoadUint64(&b.queue.rejected),
+	}
+}
+
+// buildQueue limits the number of builds in progress.
+type buildQueue struct {
+	// Keeps the 64-bit words first to guarantee their alignment for atomic operations.
+	queued, building int64
+	rejected         uint64
+	slots            chan struct{}
+	timeout          time.Duration
+}
+
+func (q *buildQueue) acquire() error {
+	if q.slots == nil {
+		atomic.AddInt64(&q.building, 1)
+		return nil
+	}
+	atomic.AddInt64(&q.queued, 1)
+	defer atomic.AddInt64(&q.queued, -1)
+
+	var timeout <-chan time.Time
+	if q.timeout > 0 {
+		t := time.NewTimer(q.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case q.slots <- struct{}{}:
+		atomic.AddInt64(&q.building, 1)
+		return nil
+	case <-timeout:
+		atomic.AddUint64(&q.rejected, 1)
+		return ErrBusy
+	}
+}
+
+func (q *buildQueue) release() {
+	atomic.AddInt64(&q.building, -1)
+	if q.slots != nil {
+		<-q.slots
+	}
+}
+
+// UseBackoff defines the time during which a failed build is not attempted again.
+// Meanwhile, the demands of the asset fail fast with the original BuildError.
+// By default, the value is 0 and the build is attempted again on the next demand.
+func (b *Box) UseBackoff(d time.Duration) *Box {
+	b.backoff = d
+	return b
+}
+
+// Hook is a function called with the name of an asset and an error related to it.
+type Hook func(name string, err error)
+
+// UseErrorHook defines the function to call with the cause
+// each time the build of an asset fails.
+func (b *Box) UseErrorHook(fn Hook) *Box {
+	b.onError = fn
+	return b
+}
+
+// UseStaleHook defines the function to call with the cause each time
+// the rebuild of an asset fails and its previous version continues to be served.
+func (b *Box) UseStaleHook(fn Hook) *Box {
+	b.onStale = fn
+	return b
+}
+
+// UseSourceMap enables or not the creation of a source map (version 3)
+// with a section by part for each asset. Its original content is included
+// for the inline and remote sources. The source map is served by the box
+// next to the asset and referenced in a sourceMappingURL comment.
+func (b *Box) UseSourceMap(ok bool) *Box {
+	b.sourceMap = ok
+	return b
+}
+
+// UseSourceRoot defines the URL prefix of the local files in the source maps,
+// like the one used to serve them with SrcTags on a development server.
+// By default, their paths are relative to the source directory.
+func (b *Box) UseSourceRoot(root string) *Box {
+	b.sourceRoot = root
+	return b
+}
+
+// UseDevMode enables or not the development mode. In this mode, the parts
+// of the assets are combined without being minified and each of them
+// is preceded by a comment naming its origin. The URLs of the assets are unchanged.
+func (b *Box) UseDevMode(ok bool) *Box {
+	b.dev = ok
+	return b
+}
+
+// UseRefresh defines the time to live of the assets with remote sources.
+// Once expired, the asset is rebuilt in background on the next demand
+// and its previous version is served until the new one is available.
+// If the refresh fails, the next attempt waits for the back-off if set,
+// see UseBackoff, for a new time to live otherwise.
+// By default, the value is 0 and the assets are never refreshed.
+func (b *Box) UseRefresh(ttl time.Duration) *Box {
+	b.ttl = ttl
+	return b
+}
+
 // UseBuildVersion overwrites the default buidd version by the given value.
 // This build ID prevents unwanted browser caching after changing of the asset.
 func (b *Box) UseBuildVersion(value string) *Box {
@@ -233,10 +750,16 @@ func (b *Box) UseBuildVersion(value string) *Box {
 }
 
 // HTTPGetter represents the mean to get data from HTTP.
+// If it also implements the Do method of the http.Client,
+// it is used instead to cancel the pending requests on failure.
 type HTTPGetter interface {
 	Get(url string) (*http.Response, error)
 }
 
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
 // UseHTTPClient allows to use your own HTTP client or proxy.
 func (b *Box) UseHTTPClient(client HTTPGetter) *Box {
 	b.http = client
@@ -264,7 +787,53 @@ func newHTTPClient() HTTPGetter {
 // Static represents the minified and combined version of the asset.
 type Static struct {
 	Link string
+	// Fallbacks lists by index of part, the origin of the alternative source
+	// used to build it when the first one was not available.
+	Fallbacks map[int]string
 	sync.WaitGroup
+
+	err        error
+	built      time.Time
+	sum        uint32
+	body       int64
+	inline     []byte
+	remote     bool
+	refreshing int32
+}
+
+// readBody returns the content of the static file, without its trailing comments
+// referencing the source map or the license file. The body has n bytes.
+func readBody(name string, n int64) ([]byte, error) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf[:n], nil
+}
+
+func (s *Static) expired(ttl time.Duration) bool {
+	return ttl > 0 && s.remote && time.Since(s.built) > ttl
+}
+
+// postpone returns a copy of the static to serve after a failed refresh.
+// It expires again once the back-off is elapsed if set, its time to live otherwise.
+func (s *Static) postpone(ttl, backoff time.Duration) *Static {
+	built := time.Now()
+	if backoff > 0 {
+		built = built.Add(backoff - ttl)
+	}
+	return &Static{
+		Link:      s.Link,
+		Fallbacks: s.Fallbacks,
+		built:     built,
+		sum:       s.sum,
+		body:      s.body,
+		inline:    s.inline,
+		remote:    s.remote,
+	}
 }
 
 // Delete deletes the value for a key.
@@ -296,13 +865,33 @@ func (b *Box) Load(key fmt.Stringer) (value *Static, ok bool) {
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
 func (b *Box) LoadOrStore(key fmt.Stringer, value *Static) (actual *Static, loaded bool) {
-	actual, loaded = b.Load(key)
+	id, err := crc32([]byte(key.String()))
+	if err != nil {
+		return value, false
+	}
+	b.min.Lock()
+	if actual, loaded = b.min.src[id]; !loaded {
+		b.min.src[id] = value
+		actual = value
+	}
+	b.min.Unlock()
 	if loaded {
 		actual.Wait()
+	}
+	return
+}
+
+// swap stores the new value for the key only if the current one is old.
+func (b *Box) swap(key fmt.Stringer, old, new *Static) (swapped bool) {
+	id, err := crc32([]byte(key.String()))
+	if err != nil {
 		return
 	}
-	b.Store(key, value)
-	actual, loaded = value, false
+	b.min.Lock()
+	if swapped = b.min.src[id] == old; swapped {
+		b.min.src[id] = new
+	}
+	b.min.Unlock()
 	return
 }
 
@@ -330,16 +919,51 @@ func (b *Box) storeRaw(key uint32, value *raw) {
 	b.raw.Unlock()
 }
 
+func (b *Box) loadCache(key uint32) (value *cached, ok bool) {
+	b.cache.RLock()
+	value, ok = b.cache.src[key]
+	b.cache.RUnlock()
+	return
+}
+
+func (b *Box) storeCache(key uint32, value *cached) {
+	b.cache.Lock()
+	b.cache.src[key] = value
+	b.cache.Unlock()
+}
+
 // List of content type
 const (
-	fileSrc   = iota // local file
-	inlineSrc        // block
-	onlineSrc        // online file
+	fileSrc     = iota // local file
+	inlineSrc          // block
+	onlineSrc          // online file
+	fallbackSrc        // list of alternatives
 )
 
 type raw struct {
 	kind int
 	buf  []byte
+	alt  []*raw
+}
+
+// cached is the minified version of a source with the validators of its content:
+// the size and the modification time of a file, or the ETag and Last-Modified
+// HTTP response headers of an URL. With source maps, it also keeps
+// the original content of an URL.
+type cached struct {
+	buf, src, lic []byte
+	size          int64
+	mod           time.Time
+	etag, lastMod string
+}
+
+// valid returns true if the validators of the cached version
+// are those of the current version of the source.
+func (c *cached) valid(cur *cached) bool {
+	if c == nil || (cur.mod.IsZero() && cur.etag == "" && cur.lastMod == "") {
+		return false
+	}
+	return c.size == cur.size && c.mod.Equal(cur.mod) && c.etag == cur.etag && c.lastMod == cur.lastMod
 }
 
 func (d *raw) crc() (uint32, error) {
@@ -354,6 +978,30 @@ func crc32(buf []byte) (uint32, error) {
 	return h.Sum32(), nil
 }
 
+// kindName returns the name of the kind of source.
+func (d *raw) kindName() string {
+	switch d.kind {
+	case fileSrc:
+		return "file"
+	case onlineSrc:
+		return "url"
+	case fallbackSrc:
+		return d.alt[0].kindName()
+	}
+	return "inline"
+}
+
+// origin returns the file path or the URL of the source.
+func (d *raw) origin() string {
+	switch d.kind {
+	case fileSrc, onlineSrc:
+		return d.String()
+	case fallbackSrc:
+		return d.alt[0].origin()
+	}
+	return "inline"
+}
+
 func (d *raw) String() string {
 	return string(d.buf[:])
 }
@@ -5,12 +5,22 @@
 package combine_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rvflash/combine"
 )
 
@@ -94,3 +104,397 @@ func TestNew(t *testing.T) {
 	}
 
 }
+
+func TestBox_Open(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&fakeHTTPClient{})
+
+	css := c.NewCSS()
+	err := css.AddFallback(
+		combine.URLSource("http://www.css.com/fail.css"),
+		combine.FileSource("f1.css"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = css.AddString(".hide{display:none;}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f, err := c.Open(css.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_ = f.Close()
+	d, ok := c.Load(css)
+	if !ok {
+		t.Fatal("expected static")
+	}
+	exp := map[int]string{0: "example/src/f1.css"}
+	if !reflect.DeepEqual(d.Fallbacks, exp) {
+		t.Errorf("mismatch fallbacks: got:%v exp:%v", d.Fallbacks, exp)
+	}
+}
+
+// Builds a fake http client which returns a new version of its content on each call.
+type versionHTTPClient struct {
+	version int32
+}
+
+// Get mocks the method of same name of the http package.
+func (c *versionHTTPClient) Get(url string) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	_, _ = fmt.Fprintf(w, ".v%d{color:red}", atomic.AddInt32(&c.version, 1))
+	return w.Result(), nil
+}
+
+func TestBox_UseRefresh(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&versionHTTPClient{})
+	c.UseRefresh(time.Millisecond)
+
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/v.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	read := func() string {
+		f, err := c.Open(css.String())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer func() { _ = f.Close() }()
+		buf, _ := ioutil.ReadAll(f)
+		return string(buf)
+	}
+	if out := read(); out != ".v1{color:red}" {
+		t.Fatalf("unexpected content: got:%q", out)
+	}
+	time.Sleep(2 * time.Millisecond)
+	// Serves the previous version during the refresh.
+	for i := 0; i < 100; i++ {
+		out := read()
+		if out == ".v1{color:red}" {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if !strings.HasPrefix(out, ".v") || !strings.HasSuffix(out, "{color:red}") {
+			t.Fatalf("unexpected content: got:%q", out)
+		}
+		return
+	}
+	t.Error("expected refreshed content")
+}
+
+// Builds a fake http client which fails once down.
+type downHTTPClient struct {
+	down, sent int32
+}
+
+// Get mocks the method of same name of the http package.
+func (c *downHTTPClient) Get(url string) (*http.Response, error) {
+	atomic.AddInt32(&c.sent, 1)
+	if atomic.LoadInt32(&c.down) == 1 {
+		return nil, errors.New("down")
+	}
+	w := httptest.NewRecorder()
+	_, _ = w.WriteString(".a{color:red}")
+	return w.Result(), nil
+}
+
+func TestBox_UseRefresh_Failure(t *testing.T) {
+	var (
+		hc    = &downHTTPClient{}
+		stale int32
+	)
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(hc).UseRefresh(5 * time.Millisecond).UseBackoff(50 * time.Millisecond)
+	c.UseStaleHook(func(name string, err error) {
+		atomic.AddInt32(&stale, 1)
+	})
+
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/a.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	read := func() {
+		f, err := c.Open(css.String())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_ = f.Close()
+	}
+	read()
+	atomic.StoreInt32(&hc.down, 1)
+	time.Sleep(10 * time.Millisecond)
+	// Only one refresh is attempted during the back-off.
+	for i := 0; i < 20; i++ {
+		read()
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&hc.sent); n != 2 {
+		t.Errorf("unexpected number of requests: got:%d exp:2", n)
+	}
+	if n := atomic.LoadInt32(&stale); n != 1 {
+		t.Errorf("unexpected number of stale hooks: got:%d exp:1", n)
+	}
+	// Then, a new attempt.
+	time.Sleep(60 * time.Millisecond)
+	read()
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&stale); n != 2 {
+		t.Errorf("unexpected number of stale hooks: got:%d exp:2", n)
+	}
+}
+
+// Builds a fake http client which counts the requests in progress.
+type slowHTTPClient struct {
+	mu         sync.Mutex
+	cur, max   int
+	fakeClient fakeHTTPClient
+}
+
+// Get mocks the method of same name of the http package.
+func (c *slowHTTPClient) Get(url string) (*http.Response, error) {
+	c.mu.Lock()
+	if c.cur++; c.cur > c.max {
+		c.max = c.cur
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.cur--
+		c.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	return c.fakeClient.Get(url)
+}
+
+func TestBox_UseFetchLimit(t *testing.T) {
+	var dt = []struct {
+		limit, max int
+	}{
+		{limit: 0, max: 1},
+		{limit: 1, max: 1},
+		{limit: 2, max: 2},
+		{limit: 10, max: 3},
+	}
+	for i, tt := range dt {
+		// Creates the registry
+		hc := &slowHTTPClient{}
+		c := combine.NewBox("", "")
+		c.UseHTTPClient(hc).UseFetchLimit(tt.limit)
+
+		js := c.NewJS()
+		err := js.AddURL("http://www.js.com/f1.js", "http://www.js.com/f1.js?v=2", "http://www.js.com/f1.js?v=3")
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if err = js.AddString(`alert("hi");`); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		w := &bytes.Buffer{}
+		if err = js.Combine(w); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if hc.max != tt.max {
+			t.Errorf("%d. mismatch concurrency: got:%d exp:%d", i, hc.max, tt.max)
+		}
+		if out := w.String(); !strings.HasSuffix(out, `alert("hi");`) || strings.Count(out, "/home.html") != 3 {
+			t.Errorf("%d. unexpected content: got:%q", i, out)
+		}
+	}
+}
+
+// Builds a fake http client which counts the requests.
+type countHTTPClient struct {
+	sent       int32
+	fakeClient fakeHTTPClient
+}
+
+// Get mocks the method of same name of the http package.
+func (c *countHTTPClient) Get(url string) (*http.Response, error) {
+	atomic.AddInt32(&c.sent, 1)
+	return c.fakeClient.Get(url)
+}
+
+func TestBox_UseBackoff(t *testing.T) {
+	var (
+		hc     = &countHTTPClient{}
+		failed []string
+	)
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(hc).UseBackoff(20 * time.Millisecond).UseErrorHook(func(name string, err error) {
+		failed = append(failed, name)
+	})
+
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/fail.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var prev error
+	for i := 0; i < 3; i++ {
+		if _, err := c.Open(css.String()); err != os.ErrPermission {
+			t.Fatalf("%d. mismatch error: got:%v exp:%v", i, err, os.ErrPermission)
+		}
+		// The original error is returned.
+		err := c.Warm(context.Background(), css).Err()
+		if prev != nil && err != prev {
+			t.Errorf("%d. mismatch error: got:%v exp:%v", i, err, prev)
+		}
+		prev = err
+	}
+	e, ok := prev.(*combine.BuildError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", prev)
+	}
+	if e.Name != css.String() || errors.Cause(e.Err) != combine.ErrNotFound {
+		t.Errorf("unexpected build error: %+v", e)
+	}
+	if n := atomic.LoadInt32(&hc.sent); n != 1 {
+		t.Errorf("mismatch number of requests: got:%d exp:%d", n, 1)
+	}
+	// Once the back-off expired, a new attempt is made.
+	time.Sleep(25 * time.Millisecond)
+	if _, err := c.Open(css.String()); err != os.ErrPermission {
+		t.Fatalf("mismatch error: got:%v exp:%v", err, os.ErrPermission)
+	}
+	if n := atomic.LoadInt32(&hc.sent); n != 2 {
+		t.Errorf("mismatch number of requests: got:%d exp:%d", n, 2)
+	}
+	if len(failed) != 2 || failed[0] != css.String() {
+		t.Errorf("mismatch failures: got:%q", failed)
+	}
+}
+
+func TestBox_Rebuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combine")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	name := filepath.Join(dir, "f.css")
+	if err = ioutil.WriteFile(name, []byte(".a{color:red}"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Creates the registry
+	var stale []string
+	c := combine.NewBox(combine.Dir(dir), combine.Dir(dir))
+	defer func() { _ = c.Close() }()
+	c.UseStaleHook(func(name string, err error) {
+		stale = append(stale, name)
+	})
+
+	css := c.NewCSS()
+	if err = css.AddFile("f.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	read := func() string {
+		f, err := c.Open(css.String())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer func() { _ = f.Close() }()
+		buf, _ := ioutil.ReadAll(f)
+		return string(buf)
+	}
+	var dt = []struct {
+		content string
+		out     string
+		err     bool
+		stale   int
+	}{
+		{content: ".bb{color:red}", out: ".bb{color:red}"},
+		{out: ".bb{color:red}", err: true, stale: 1},
+		{content: ".ccc{color:red}", out: ".ccc{color:red}", stale: 1},
+	}
+	if out := read(); out != ".a{color:red}" {
+		t.Fatalf("mismatch content: got:%q", out)
+	}
+	for i, tt := range dt {
+		if tt.content == "" {
+			err = os.Remove(name)
+		} else {
+			err = ioutil.WriteFile(name, []byte(tt.content), 0644)
+		}
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if err = c.Rebuild(css); (err != nil) != tt.err {
+			t.Errorf("%d. unexpected error: %v", i, err)
+		}
+		if out := read(); out != tt.out {
+			t.Errorf("%d. mismatch content: got:%q exp:%q", i, out, tt.out)
+		}
+		if len(stale) != tt.stale {
+			t.Errorf("%d. mismatch stale hooks: got:%d exp:%d", i, len(stale), tt.stale)
+		}
+	}
+}
+
+func TestSourceError_Error(t *testing.T) {
+	var dt = []struct {
+		in  *combine.SourceError
+		out string
+	}{
+		{
+			in:  &combine.SourceError{Err: combine.ErrNotFound},
+			out: "part 0: not found",
+		},
+		{
+			in:  &combine.SourceError{Kind: "url", Source: "http://rv.com/f1.css", Index: 2, Err: combine.ErrNotFound},
+			out: "part 2, url http://rv.com/f1.css: not found",
+		},
+		{
+			in:  &combine.SourceError{Kind: "inline", Source: "inline", Index: 1, Err: errNoTransport, Line: 3, Column: 12},
+			out: "part 1, inline:3:12: no transport",
+		},
+		{
+			in:  &combine.SourceError{Kind: "file", Source: "src/f1.js", Err: errNoTransport, Line: 1, Column: 5},
+			out: "part 0, file src/f1.js:1:5: no transport",
+		},
+	}
+	for i, tt := range dt {
+		if out := tt.in.Error(); out != tt.out {
+			t.Errorf("%d. mismatch content: got:%q exp:%q", i, out, tt.out)
+		}
+	}
+}
+
+func TestBox_UseDevMode(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&fakeHTTPClient{}).UseDevMode(true)
+
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := css.AddString(".hide{display:none;}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := css.AddURL("http://www.css.com/f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w := &bytes.Buffer{}
+	if err := css.Combine(w); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp := "/* " + filepath.Join("example", "src", "f1.css") + " */\n/* comment */\n.show{display: block;}\n" +
+		"/* inline #1 */\n.hide{display:none;}\n" +
+		"/* http://www.css.com/f1.css */\n\n/* an other comment */\n.red{\n\tcolor:#f00;\n}\n"
+	if out := w.String(); out != exp {
+		t.Errorf("mismatch content: got:%q exp:%q", out, exp)
+	}
+}
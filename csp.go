@@ -0,0 +1,119 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// Hash returns the source expression of a Content-Security-Policy allowing
+// an inline script or style element with this text, as 'sha256-...'.
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// SrcHashes returns the source expressions of the Content-Security-Policy
+// allowing the inline blocks rendered by SrcTags, in order and without duplicate.
+func (a *asset) SrcHashes() []string {
+	var hashes []string
+	a.reg.raw.RLock()
+	for _, key := range a.media {
+		src := a.reg.raw.src[key]
+		if src.kind == fallbackSrc {
+			// Only the first source is rendered.
+			src = src.alt[0]
+		}
+		if src.kind != inlineSrc {
+			continue
+		}
+		if text, err := inlineText(a.kind, src.buf); err == nil {
+			hashes = appendOnce(hashes, Hash(text))
+		}
+	}
+	a.reg.raw.RUnlock()
+	return hashes
+}
+
+// CSP aggregates the hashes of the inline blocks of the assets of a page
+// to build the script-src and style-src directives of its Content-Security-Policy.
+// The zero value is ready to use.
+type CSP struct {
+	Script, Style []string
+}
+
+// Add adds the hashes of the inline blocks rendered by SrcTags for these assets.
+func (c *CSP) Add(files ...File) {
+	for _, f := range files {
+		a, ok := f.(*asset)
+		if !ok {
+			continue
+		}
+		for _, h := range a.SrcHashes() {
+			c.add(a.kind, h)
+		}
+	}
+}
+
+// AddTag adds the hashes of these assets when Tag renders them inline,
+// with the automatic inline rendering.
+func (c *CSP) AddTag(files ...File) {
+	for _, f := range files {
+		a, ok := f.(*asset)
+		if !ok {
+			continue
+		}
+		if text, ok := a.autoInline(); ok {
+			c.add(a.kind, Hash(text))
+		}
+	}
+}
+
+// AddInline adds the hashes of these assets rendered by Inline.
+// It fails if one of them can not be built.
+func (c *CSP) AddInline(files ...File) error {
+	for _, f := range files {
+		a, ok := f.(*asset)
+		if !ok || len(a.media) == 0 {
+			continue
+		}
+		text, err := a.inline()
+		if err != nil {
+			return err
+		}
+		c.add(a.kind, Hash(text))
+	}
+	return nil
+}
+
+func (c *CSP) add(kind, hash string) {
+	if kind == JavaScript {
+		c.Script = appendOnce(c.Script, hash)
+	} else {
+		c.Style = appendOnce(c.Style, hash)
+	}
+}
+
+// ScriptSrc returns the list of hashes to add in the script-src directive.
+func (c *CSP) ScriptSrc() string {
+	return strings.Join(c.Script, " ")
+}
+
+// StyleSrc returns the list of hashes to add in the style-src directive.
+func (c *CSP) StyleSrc() string {
+	return strings.Join(c.Style, " ")
+}
+
+// appendOnce appends s to the list if it's not already inside.
+func appendOnce(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestHash(t *testing.T) {
+	var dt = []struct {
+		in, out string
+	}{
+		{in: "alert('Hello, world.');", out: "'sha256-qznLcsROx4GACP2dm0UCKCzCG+HiZ1guq6ZZDob/Tng='"},
+		{in: "", out: "'sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU='"},
+	}
+	for i, tt := range dt {
+		if out := combine.Hash(tt.in); out != tt.out {
+			t.Errorf("%d. hash mismatch: got=%q, exp=%q", i, out, tt.out)
+		}
+	}
+}
+
+func TestCSP_Add(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := js.AddString("alert('Hello, world.');", "var a = 56;", "alert('Hello, world.');"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddString(".black{color:#000;}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp := []string{combine.Hash("alert('Hello, world.');"), combine.Hash("var a = 56;")}
+	if out := js.SrcHashes(); !reflect.DeepEqual(out, exp) {
+		t.Errorf("mismatch hashes: got=%q, exp=%q", out, exp)
+	}
+	p := &combine.CSP{}
+	p.Add(js, css, js)
+	if out := p.ScriptSrc(); out != strings.Join(exp, " ") {
+		t.Errorf("mismatch script-src: got=%q", out)
+	}
+	if out := p.StyleSrc(); out != combine.Hash(".black{color:#000;}") {
+		t.Errorf("mismatch style-src: got=%q", out)
+	}
+	// The hashes match the content of the inline blocks.
+	if out := css.SrcTags("/"); out != "<style>.black{color:#000;}</style>" {
+		t.Errorf("mismatch style tag: got=%q", out)
+	}
+}
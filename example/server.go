@@ -42,7 +42,7 @@ func main() {
 
 	// Launches the HTTP server.
 	http.Handle("/", &homeHandler{static})
-	http.Handle("/min/", http.FileServer(static))
+	http.Handle("/min/", static)
 	if err := http.ListenAndServe(":6060", nil); err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
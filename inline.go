@@ -0,0 +1,67 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+// UseInlineLimit enables the automatic inline rendering of the assets by Tag:
+// the ones whose combined and minified version weighs less than n bytes
+// are rendered inline, the others are linked. The combined version is built
+// on the first rendering, if needed. By default, 0 disables it.
+func (b *Box) UseInlineLimit(n int64) *Box {
+	if n < 0 {
+		n = 0
+	}
+	b.inlineLimit = n
+	return b
+}
+
+// Inline returns a HTML5 tag with the minified and combined content of the asset inline,
+// with the given attributes. It is built if needed, or the last build is reused.
+// Its content is escaped to prevent the end of the element.
+// ErrInline is returned if it can not be escaped safely.
+func (a *asset) Inline(attrs ...Attr) (string, error) {
+	if len(a.media) == 0 {
+		return "", nil
+	}
+	text, err := a.inline()
+	if err != nil {
+		return "", err
+	}
+	return htmlTag(a.kind, text, true, attrs), nil
+}
+
+// inline returns the escaped text of the combined version of the asset,
+// without the comments referencing its source map or its license file.
+func (a *asset) inline() (string, error) {
+	d, err := a.reg.static(a)
+	if err != nil {
+		return "", err
+	}
+	buf := d.inline
+	if buf == nil {
+		if buf, err = readBody(d.Link, d.body); err != nil {
+			return "", err
+		}
+	}
+	return inlineText(a.kind, buf)
+}
+
+// autoInline returns the text to render inline by Tag and true,
+// if the automatic inline rendering is enabled and the asset is small enough.
+// A script which can not be escaped safely is linked.
+func (a *asset) autoInline() (string, bool) {
+	if a.reg.inlineLimit == 0 || len(a.media) == 0 {
+		return "", false
+	}
+	d, err := a.reg.static(a)
+	if err != nil || d.inline == nil {
+		// Falls back on a link.
+		return "", false
+	}
+	text, err := inlineText(a.kind, d.inline)
+	if err != nil {
+		return "", false
+	}
+	return text, true
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestAsset_Inline(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Disables the build version to avoid variance.
+	// Mocks the HTTP client.
+	c.UseBuildVersion("").UseHTTPClient(&fakeHTTPClient{})
+
+	js := c.NewJS()
+	if err := js.AddString("var a=56;", `var b="</script>";`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		in    combine.File
+		attrs []combine.Attr
+		out   string
+		err   bool
+	}{
+		{in: c.NewJS()},
+		{in: js, out: `<script>var a=56;var b="<\/script>";</script>`},
+		{in: js, attrs: []combine.Attr{combine.Nonce("abc")}, out: `<script nonce="abc">var a=56;var b="<\/script>";</script>`},
+		{in: func() combine.File {
+			f := c.NewCSS()
+			_ = f.AddURL("http://www.css.com/fail.css")
+			return f
+		}(), err: true},
+		// The minifier joins the operator and the variable.
+		{in: func() combine.File {
+			f := c.NewJS()
+			_ = f.AddString("var c = a < script;")
+			return f
+		}(), out: `<script>var c=a< script;</script>`},
+	}
+	for i, tt := range dt {
+		out, err := tt.in.Inline(tt.attrs...)
+		if (err != nil) != tt.err {
+			t.Fatalf("%d. unexpected error: %v", i, err)
+		}
+		if out != tt.out {
+			t.Errorf("%d. tag mismatch: got=%q, exp=%q", i, out, tt.out)
+		}
+	}
+	p := &combine.CSP{}
+	if err := p.AddInline(js); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exp := combine.Hash(`var a=56;var b="<\/script>";`); p.ScriptSrc() != exp {
+		t.Errorf("hash mismatch: got=%q, exp=%q", p.ScriptSrc(), exp)
+	}
+}
+
+func TestBox_UseInlineLimit(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine").UseInlineLimit(20)
+	defer func() { _ = c.Close() }()
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	small := c.NewCSS()
+	if err := small.AddString(".a{color:red}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	big := c.NewCSS()
+	if err := big.AddString(".a{color:red}", ".b{color:blue}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out := small.TagAttrs("/", combine.Attr{Key: "media", Val: "print"}); out != `<style media="print">.a{color:red}</style>` {
+		t.Errorf("expected inline tag: got=%q", out)
+	}
+	if out := big.Tag("/"); !strings.HasPrefix(out, `<link rel="stylesheet" href="/`) {
+		t.Errorf("expected link tag: got=%q", out)
+	}
+	p := &combine.CSP{}
+	p.AddTag(small, big)
+	if exp := combine.Hash(".a{color:red}"); p.StyleSrc() != exp {
+		t.Errorf("hash mismatch: got=%q, exp=%q", p.StyleSrc(), exp)
+	}
+}
+
+func TestAsset_Inline_Trailers(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine").UseInlineLimit(20)
+	defer func() { _ = c.Close() }()
+	// The comments referencing the source map and the license file are not rendered inline.
+	c.UseBuildVersion("").UseSourceMap(true).UseLicense(combine.ExtractLicense)
+
+	css := c.NewCSS()
+	if err := css.AddString("/*! MIT */.a{color:red}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	const exp = `<style>.a{color:red}</style>`
+	if out := css.Tag("/"); out != exp {
+		t.Errorf("tag mismatch: got=%q, exp=%q", out, exp)
+	}
+	out, err := css.Inline()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out != exp {
+		t.Errorf("inline mismatch: got=%q, exp=%q", out, exp)
+	}
+	p := &combine.CSP{}
+	p.AddTag(css)
+	if err = p.AddInline(css); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exp := combine.Hash(".a{color:red}"); p.StyleSrc() != exp {
+		t.Errorf("hash mismatch: got=%q, exp=%q", p.StyleSrc(), exp)
+	}
+	// The static file keeps them.
+	f, err := c.Open(css.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = f.Close() }()
+	buf, _ := ioutil.ReadAll(f)
+	if !strings.Contains(string(buf), "sourceMappingURL=") || !strings.Contains(string(buf), ".LICENSE.txt") {
+		t.Errorf("expected trailing comments: got=%q", buf)
+	}
+}
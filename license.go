@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+
+	"github.com/tdewolff/parse/css"
+	"github.com/tdewolff/parse/js"
+)
+
+// License defines what to do with the license comments of the sources,
+// the comments starting with /*! or containing a @license tag.
+type License int
+
+// List of license modes.
+const (
+	// DefaultLicense lets the minifier deal with the license comments.
+	// Only the /*! ones outside the rules are kept. It is the default mode.
+	DefaultLicense License = iota
+	// KeepLicense keeps the license comments inline, at the top of each part.
+	KeepLicense
+	// ExtractLicense extracts the license comments in a companion file
+	// named as the asset with a .LICENSE.txt extension and referenced from it.
+	ExtractLicense
+)
+
+// Extension of the companion file of an asset listing the license comments.
+const licenseExt = ".LICENSE.txt"
+
+// UseLicense defines the way to deal with the license comments of the sources.
+// By default, the minifier keeps the /*! comments, in place, and removes the others.
+func (b *Box) UseLicense(mode License) *Box {
+	b.license = mode
+	return b
+}
+
+// splitLicenses returns the source without its license comments and these comments, in order.
+// The comments are found by the lexer of the media type, so a comment marker inside
+// a string or a regular expression is ignored. If the source can not be read,
+// it is returned as is.
+func splitLicenses(kind string, src []byte) (out, lic []byte) {
+	var body, buf bytes.Buffer
+	err := walkTokens(kind, src, func(text []byte, comment bool) {
+		if comment && isLicense(text) {
+			buf.Write(bytes.TrimSpace(text))
+			buf.WriteByte('\n')
+			return
+		}
+		body.Write(text)
+	})
+	if err != nil {
+		return src, nil
+	}
+	return body.Bytes(), buf.Bytes()
+}
+
+// isLicense returns true if the comment is a /*! one or contains a @license tag.
+func isLicense(comment []byte) bool {
+	return bytes.HasPrefix(comment, []byte("/*!")) || bytes.Contains(comment, []byte("@license"))
+}
+
+// walkTokens calls fn with each token of the source, in order,
+// telling if it is a comment.
+func walkTokens(kind string, src []byte, fn func(text []byte, comment bool)) error {
+	switch kind {
+	case CSS:
+		l := css.NewLexer(bytes.NewReader(src))
+		for {
+			tt, text := l.Next()
+			if tt == css.ErrorToken {
+				return lexErr(l.Err())
+			}
+			fn(text, tt == css.CommentToken)
+		}
+	case JavaScript:
+		l := js.NewLexer(bytes.NewReader(src))
+		for {
+			tt, text := l.Next()
+			if tt == js.ErrorToken {
+				return lexErr(l.Err())
+			}
+			fn(text, tt == js.CommentToken)
+		}
+	}
+	return ErrMime
+}
+
+// lexErr returns the error of the lexer, if it is not the end of the source.
+func lexErr(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// licenseComment returns the comment to link the asset to its license file.
+func licenseComment(name string) string {
+	return "\n/*! For license information please see " + filepath.Base(name) + licenseExt + " */"
+}
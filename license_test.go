@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestBox_UseLicense(t *testing.T) {
+	var dt = []struct {
+		mode      combine.License
+		mediaType string
+		in        []string
+		inline    string
+		extract   string
+		out       string
+	}{
+		{mode: combine.DefaultLicense, mediaType: combine.CSS, in: []string{"/*! MIT */.a{color:red}"}},
+		{
+			mode:      combine.KeepLicense,
+			mediaType: combine.CSS,
+			in:        []string{"/*! MIT */.a{color:red}", "/* comment */.b{color:blue}"},
+			inline:    "/*! MIT */\n",
+		},
+		{
+			mode:      combine.ExtractLicense,
+			mediaType: combine.CSS,
+			in:        []string{"/*! MIT */.a{color:red}", "/* comment */.b{color:blue}", "/* @license Apache */.c{}"},
+			extract:   "/*! MIT */\n/* @license Apache */\n",
+		},
+		{
+			mode:      combine.ExtractLicense,
+			mediaType: combine.JavaScript,
+			in:        []string{"// @license ISC\nvar a = 1;", "// comment\nvar b = 2;"},
+			extract:   "// @license ISC\n",
+		},
+		{mode: combine.ExtractLicense, mediaType: combine.JavaScript, in: []string{"var a = 1;"}},
+		// The comment markers inside the strings or regular expressions are ignored.
+		{
+			mode:      combine.ExtractLicense,
+			mediaType: combine.JavaScript,
+			in:        []string{`var p = "/*!"; code(); /* x */`, "var r = /\\/*!/; /*! MIT */ done();"},
+			extract:   "/*! MIT */\n",
+			out:       `var p="/*!";code();var r=/\/*!/;done();`,
+		},
+		{
+			mode:      combine.KeepLicense,
+			mediaType: combine.CSS,
+			in:        []string{`.a::after{content:"/*! x"} /* y */ .b{color:red}`},
+			out:       `.a::after{content:"/*! x"}.b{color:red}`,
+		},
+	}
+	for i, tt := range dt {
+		c := combine.NewBox("./example/src", "./example/combine").UseLicense(tt.mode)
+		f := c.NewCSS()
+		if tt.mediaType == combine.JavaScript {
+			f = c.NewJS()
+		}
+		for _, s := range tt.in {
+			if err := f.AddString(s); err != nil {
+				t.Fatalf("%d. unexpected error: %s", i, err)
+			}
+		}
+		w := &bytes.Buffer{}
+		if err := f.Combine(w); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if tt.inline != "" && (!strings.HasPrefix(w.String(), tt.inline) || strings.Count(w.String(), "MIT") > 1) {
+			t.Errorf("%d. expected inline license: got:%q", i, w.String())
+		}
+		if tt.out != "" && w.String() != tt.out {
+			t.Errorf("%d. content mismatch: got:%q exp:%q", i, w.String(), tt.out)
+		}
+		o, err := c.Open(f.String())
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		buf, _ := ioutil.ReadAll(o)
+		_ = o.Close()
+		ref := "For license information please see " + f.String() + ".LICENSE.txt"
+		if strings.Contains(string(buf), ref) != (tt.extract != "") {
+			t.Errorf("%d. unexpected license reference: got:%q", i, buf)
+		}
+		o, err = c.Open(f.String() + ".LICENSE.txt")
+		if tt.extract == "" {
+			if err == nil {
+				_ = o.Close()
+				t.Errorf("%d. expected no license file", i)
+			}
+			_ = c.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		buf, _ = ioutil.ReadAll(o)
+		_ = o.Close()
+		if string(buf) != tt.extract {
+			t.Errorf("%d. license mismatch: got:%q exp:%q", i, buf, tt.extract)
+		}
+		_ = c.Close()
+	}
+}
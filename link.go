@@ -0,0 +1,201 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// Rel is the relation between a page and an asset linked with a Link HTTP header
+// or a link HTML element.
+type Rel string
+
+// List of relations.
+const (
+	// Preload fetches the asset as soon as possible for the current page.
+	Preload Rel = "preload"
+	// Prefetch fetches the asset with a low priority for a next navigation.
+	Prefetch Rel = "prefetch"
+	// ModulePreload preloads a JavaScript module and its dependencies.
+	ModulePreload Rel = "modulepreload"
+	// Preconnect opens in advance a connection to an origin.
+	Preconnect Rel = "preconnect"
+)
+
+// CrossOriginAttr returns the crossorigin attribute with this CORS mode,
+// anonymous or use-credentials. Without mode, the attribute has no value.
+func CrossOriginAttr(mode string) Attr {
+	return Attr{Key: "crossorigin", Val: mode}
+}
+
+// TypeAttr returns the type attribute with this MIME type, like module.
+func TypeAttr(mimeType string) Attr {
+	return Attr{Key: "type", Val: mimeType}
+}
+
+// MediaAttr returns the media attribute with this media query.
+func MediaAttr(query string) Attr {
+	return Attr{Key: "media", Val: query}
+}
+
+// LinkRel returns the Link HTTP response header to link the asset with this relation,
+// followed by the given parameters. The rel and as parameters are reserved and ignored.
+func (a *asset) LinkRel(root Dir, rel Rel, attrs ...Attr) string {
+	s := "<" + a.Path(root) + ">; rel=" + string(rel)
+	if as := a.as(rel); as != "" {
+		s += "; as=" + as
+	}
+	return s + linkParams(without(attrs, "rel", "as"))
+}
+
+// LinkTag returns a link HTML element to link the asset with this relation,
+// with the given attributes. The rel and as attributes are reserved and ignored.
+func (a *asset) LinkTag(root Dir, rel Rel, attrs ...Attr) string {
+	s := a.Path(root)
+	if s == "" {
+		return ""
+	}
+	s = `<link rel="` + html.EscapeString(string(rel)) + `" href="` + html.EscapeString(s) + `"`
+	if as := a.as(rel); as != "" {
+		s += ` as="` + as + `"`
+	}
+	return s + htmlAttrs(without(attrs, "rel", "as")) + ">"
+}
+
+// as returns the destination of the asset to fetch with this relation.
+// A module is always a script.
+func (a *asset) as(rel Rel) string {
+	switch rel {
+	case Preload, Prefetch:
+		if a.kind == JavaScript {
+			return "script"
+		}
+		return "style"
+	}
+	return ""
+}
+
+// Origins returns the origins of the remote sources of the asset, in order and
+// without duplicate. They are the ones to preconnect to, when the sources are
+// rendered by SrcTags.
+func (a *asset) Origins() []string {
+	var origins []string
+	a.reg.raw.RLock()
+	for _, key := range a.media {
+		src := a.reg.raw.src[key]
+		if src.kind == fallbackSrc {
+			// Only the first source is rendered.
+			src = src.alt[0]
+		}
+		if src.kind != onlineSrc {
+			continue
+		}
+		if u, err := url.Parse(string(src.buf)); err == nil && u.Host != "" {
+			origins = appendOnce(origins, u.Scheme+"://"+u.Host)
+		}
+	}
+	a.reg.raw.RUnlock()
+	return origins
+}
+
+// PreconnectLink returns the Link HTTP response header to preconnect to this origin,
+// followed by the given parameters, like crossorigin.
+func PreconnectLink(origin string, attrs ...Attr) string {
+	return "<" + origin + ">; rel=" + string(Preconnect) + linkParams(without(attrs, "rel"))
+}
+
+// PreconnectTag returns a link HTML element to preconnect to this origin,
+// with the given attributes.
+func PreconnectTag(origin string, attrs ...Attr) string {
+	return `<link rel="` + string(Preconnect) + `" href="` + html.EscapeString(origin) + `"` +
+		htmlAttrs(without(attrs, "rel")) + ">"
+}
+
+// without returns the attributes without the ones with these keys.
+func without(attrs []Attr, keys ...string) []Attr {
+	res := make([]Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if !containsFold(keys, a.Key) {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// attrValue returns the value of the last attribute with this key, if any.
+func attrValue(attrs []Attr, key string) (val string) {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Key, key) {
+			val = a.Val
+		}
+	}
+	return
+}
+
+// jsQuote escapes a text to put in a single quoted JavaScript string.
+var jsQuote = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AsyncCSS is a pattern to load a style sheet without blocking the rendering of the page.
+type AsyncCSS int
+
+// List of patterns of asynchronous loading.
+const (
+	// PreloadCSS preloads the style sheet and applies it once loaded,
+	// with a noscript element as fallback.
+	PreloadCSS AsyncCSS = iota
+	// PrintCSS loads the style sheet for the print media and applies it
+	// to the requested media once loaded, all by default, with a noscript
+	// element as fallback.
+	PrintCSS
+)
+
+// Handlers applying the style sheet once loaded, by pattern.
+var asyncOnload = map[AsyncCSS]string{
+	PreloadCSS: `this.onload=null;this.rel='stylesheet'`,
+	PrintCSS:   `this.onload=null;this.media='all'`,
+}
+
+// AsyncTag returns the HTML5 tags to load the CSS asset without blocking the rendering
+// of the page, with the given pattern and attributes, like a nonce.
+// The rel, as and onload attributes are reserved. With PrintCSS, the media attribute
+// is the one applied once the style sheet is loaded. As its onload handler is inline, a Content-Security-Policy
+// must allow it with 'unsafe-hashes' and its hash.
+// A JavaScript asset is rendered as with TagAttrs, the async or defer attributes
+// are the ways to not block the rendering. The same for an asset rendered inline.
+func (a *asset) AsyncTag(root Dir, mode AsyncCSS, attrs ...Attr) string {
+	onload, ok := asyncOnload[mode]
+	if a.kind != CSS || !ok {
+		return a.TagAttrs(root, attrs...)
+	}
+	if text, ok := a.autoInline(); ok {
+		return htmlTag(a.kind, text, true, attrs)
+	}
+	s := a.Path(root)
+	if s == "" {
+		return ""
+	}
+	href := html.EscapeString(s)
+	noscript := `<noscript>` + htmlTag(a.kind, s, false, without(attrs, "rel", "as", "onload")) + `</noscript>`
+	if mode == PrintCSS {
+		if media := attrValue(attrs, "media"); media != "" {
+			onload = `this.onload=null;this.media='` + html.EscapeString(jsQuote.Replace(media)) + `'`
+		}
+		at := htmlAttrs(without(attrs, "rel", "as", "media", "onload"))
+		return `<link rel="stylesheet" href="` + href + `" media="print" onload="` + onload + `"` + at + `>` + noscript
+	}
+	at := htmlAttrs(without(attrs, "rel", "as", "onload"))
+	return `<link rel="preload" href="` + href + `" as="style" onload="` + onload + `"` + at + `>` + noscript
+}
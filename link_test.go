@@ -0,0 +1,165 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestAsset_LinkRel(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js", "f2.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		in        combine.File
+		rel       combine.Rel
+		attrs     []combine.Attr
+		link, tag string
+	}{
+		{
+			in:   js,
+			rel:  combine.Preload,
+			link: "</static/883963153.0.1831620815.js>; rel=preload; as=script",
+			tag:  `<link rel="preload" href="/static/883963153.0.1831620815.js" as="script">`,
+		},
+		{
+			in:    css,
+			rel:   combine.Prefetch,
+			attrs: []combine.Attr{combine.MediaAttr("print"), {Key: "as", Val: "image"}},
+			link:  "</static/444270761.0.css>; rel=prefetch; as=style; media=print",
+			tag:   `<link rel="prefetch" href="/static/444270761.0.css" as="style" media="print">`,
+		},
+		{
+			in:    js,
+			rel:   combine.ModulePreload,
+			attrs: []combine.Attr{combine.CrossOriginAttr("use-credentials"), combine.TypeAttr("module")},
+			link:  "</static/883963153.0.1831620815.js>; rel=modulepreload; crossorigin=use-credentials; type=module",
+			tag:   `<link rel="modulepreload" href="/static/883963153.0.1831620815.js" crossorigin="use-credentials" type="module">`,
+		},
+		{
+			in:    css,
+			rel:   combine.Preload,
+			attrs: []combine.Attr{combine.CrossOriginAttr(""), combine.TypeAttr("text/css")},
+			link:  `</static/444270761.0.css>; rel=preload; as=style; crossorigin; type="text/css"`,
+			tag:   `<link rel="preload" href="/static/444270761.0.css" as="style" crossorigin type="text/css">`,
+		},
+	}
+	for i, tt := range dt {
+		if out := tt.in.LinkRel("/static/", tt.rel, tt.attrs...); out != tt.link {
+			t.Errorf("%d. link mismatch: got=%q, exp=%q", i, out, tt.link)
+		}
+		if out := tt.in.LinkTag("/static/", tt.rel, tt.attrs...); out != tt.tag {
+			t.Errorf("%d. tag mismatch: got=%q, exp=%q", i, out, tt.tag)
+		}
+	}
+	if out := c.NewJS().LinkTag("/static/", combine.Preload); out != "" {
+		t.Errorf("unexpected tag: got=%q", out)
+	}
+}
+
+func TestAsset_Origins(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+
+	css := c.NewCSS()
+	if err := css.AddURL("https://fonts.example.com/a.css", "https://cdn.example.com/b.css", "https://fonts.example.com/c.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp := []string{"https://fonts.example.com", "https://cdn.example.com"}
+	out := css.Origins()
+	if !reflect.DeepEqual(out, exp) {
+		t.Fatalf("mismatch origins: got=%q, exp=%q", out, exp)
+	}
+	if s := combine.PreconnectLink(out[0], combine.CrossOriginAttr("")); s != "<https://fonts.example.com>; rel=preconnect; crossorigin" {
+		t.Errorf("mismatch link: got=%q", s)
+	}
+	if s := combine.PreconnectTag(out[1]); s != `<link rel="preconnect" href="https://cdn.example.com">` {
+		t.Errorf("mismatch tag: got=%q", s)
+	}
+}
+
+func TestAsset_AsyncTag(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js", "f2.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		in    combine.File
+		mode  combine.AsyncCSS
+		attrs []combine.Attr
+		out   string
+	}{
+		{in: c.NewCSS()},
+		{
+			in:   css,
+			mode: combine.PreloadCSS,
+			out: `<link rel="preload" href="/static/444270761.0.css" as="style" onload="this.onload=null;this.rel='stylesheet'">` +
+				`<noscript><link rel="stylesheet" href="/static/444270761.0.css"></noscript>`,
+		},
+		{
+			in:    css,
+			mode:  combine.PreloadCSS,
+			attrs: []combine.Attr{combine.Nonce("abc"), {Key: "onload", Val: "alert(1)"}},
+			out: `<link rel="preload" href="/static/444270761.0.css" as="style" onload="this.onload=null;this.rel='stylesheet'" nonce="abc">` +
+				`<noscript><link rel="stylesheet" href="/static/444270761.0.css" nonce="abc"></noscript>`,
+		},
+		{
+			in:    css,
+			mode:  combine.PrintCSS,
+			attrs: []combine.Attr{combine.MediaAttr("screen")},
+			out: `<link rel="stylesheet" href="/static/444270761.0.css" media="print" onload="this.onload=null;this.media='screen'">` +
+				`<noscript><link rel="stylesheet" href="/static/444270761.0.css" media="screen"></noscript>`,
+		},
+		{
+			in:   css,
+			mode: combine.PrintCSS,
+			out: `<link rel="stylesheet" href="/static/444270761.0.css" media="print" onload="this.onload=null;this.media='all'">` +
+				`<noscript><link rel="stylesheet" href="/static/444270761.0.css"></noscript>`,
+		},
+		{
+			in:    css,
+			mode:  combine.PrintCSS,
+			attrs: []combine.Attr{combine.MediaAttr(`screen');alert("1`)},
+			out: `<link rel="stylesheet" href="/static/444270761.0.css" media="print" onload="this.onload=null;this.media='screen\&#39;);alert(&#34;1'">` +
+				`<noscript><link rel="stylesheet" href="/static/444270761.0.css" media="screen&#39;);alert(&#34;1"></noscript>`,
+		},
+		{
+			in:    js,
+			mode:  combine.PrintCSS,
+			attrs: []combine.Attr{{Key: "defer"}},
+			out:   `<script src="/static/883963153.0.1831620815.js" defer></script>`,
+		},
+	}
+	for i, tt := range dt {
+		if out := tt.in.AsyncTag("/static/", tt.mode, tt.attrs...); out != tt.out {
+			t.Errorf("%d. tag mismatch: got=%q, exp=%q", i, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tdewolff/minify"
+	"github.com/tdewolff/minify/css"
+	"github.com/tdewolff/minify/js"
+)
+
+// optsMap registers the minifiers in use by their identifier.
+// The default one by media type is also kept.
+type optsMap struct {
+	src map[uint32]minify.Minifier
+	def map[string]uint32
+	sync.RWMutex
+}
+
+// Keyer must be implemented by a custom minifier to be used by the box.
+// MinifierKey returns the settings of the minifier, like "decimals=2".
+// As part of the name of the assets, it must be stable over time:
+// two minifiers of the same type with the same key are considered as equal.
+type Keyer interface {
+	MinifierKey() string
+}
+
+// optsKey returns the settings of the minifier.
+// In this version of the package minify, the js.Minifier has no option:
+// it always removes the comments, except the /*! ones, and can not keep
+// the names of the variables.
+func optsKey(m minify.Minifier) (string, error) {
+	switch v := m.(type) {
+	case Keyer:
+		return v.MinifierKey(), nil
+	case *css.Minifier:
+		return "decimals=" + strconv.Itoa(v.Decimals), nil
+	case *js.Minifier:
+		return "", nil
+	}
+	return "", ErrMinifier
+}
+
+// optsID returns the identifier of the settings of the minifier.
+// Two minifiers with the same type and key share the same one.
+func optsID(m minify.Minifier) (uint32, error) {
+	key, err := optsKey(m)
+	if err != nil {
+		return 0, err
+	}
+	return crc32([]byte(fmt.Sprintf("%T:%s", m, key)))
+}
+
+// register stores the minifier and returns its identifier.
+func (o *optsMap) register(m minify.Minifier) (uint32, error) {
+	id, err := optsID(m)
+	if err != nil {
+		return 0, err
+	}
+	o.Lock()
+	o.src[id] = m
+	o.Unlock()
+	return id, nil
+}
+
+// load returns the minifier behind this identifier.
+func (o *optsMap) load(id uint32) (m minify.Minifier, ok bool) {
+	o.RLock()
+	m, ok = o.src[id]
+	o.RUnlock()
+	return
+}
+
+// UseMinifier defines the minifier to use by default with this media type,
+// like a css.Minifier with a custom decimal precision.
+// Its settings are part of the name of the assets, so their statics are
+// never shared with the ones minified with other settings.
+// Besides the css.Minifier and js.Minifier, the minifier must implement Keyer,
+// otherwise ErrMinifier is returned and the current one is kept.
+// A nil minifier restores the default one. An unknown media type returns ErrMime.
+func (b *Box) UseMinifier(mediaType string, m minify.Minifier) (*Box, error) {
+	if mediaType != CSS && mediaType != JavaScript {
+		return b, ErrMime
+	}
+	var id uint32
+	if m != nil {
+		var err error
+		if id, err = b.opts.register(m); err != nil {
+			return b, err
+		}
+	}
+	b.opts.Lock()
+	b.opts.def[mediaType] = id
+	b.opts.Unlock()
+	return b, nil
+}
+
+// UseMinifier defines the minifier of this asset, instead of the default one of its box.
+// A nil minifier restores the default settings. A minifier without known settings
+// returns ErrMinifier, see Box.UseMinifier.
+// It must be called before any naming of the asset.
+func (a *asset) UseMinifier(m minify.Minifier) (File, error) {
+	if m == nil {
+		a.opts = 0
+		return a, nil
+	}
+	id, err := a.reg.opts.register(m)
+	if err != nil {
+		return a, err
+	}
+	a.opts = id
+	return a, nil
+}
+
+// newMinify returns the minifier to use with this asset.
+func (a *asset) newMinify() (m *minify.M, err error) {
+	m = minify.New()
+	if o, ok := a.reg.opts.load(a.opts); ok {
+		m.Add(a.kind, o)
+		return
+	}
+	switch a.kind {
+	case JavaScript:
+		m.AddFunc(a.kind, js.Minify)
+	case CSS:
+		m.AddFunc(a.kind, css.Minify)
+	default:
+		err = ErrMime
+	}
+	return
+}
+
+// optsSuffix returns the suffix to add to the name of the asset to identify its minifier.
+func (a *asset) optsSuffix() string {
+	if a.opts == 0 {
+		return ""
+	}
+	return "-" + strconv.FormatUint(uint64(a.opts), 10)
+}
+
+// splitOpts extracts the identifier of the minifier from the hash of an asset.
+// The minifier must be known by the box.
+func (b *Box) splitOpts(hash string) (string, uint32, error) {
+	i := strings.LastIndexByte(hash, '-')
+	if i < 0 {
+		return hash, 0, nil
+	}
+	id, err := strconv.ParseUint(hash[i+1:], 10, 32)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, ok := b.opts.load(uint32(id)); !ok {
+		return "", 0, ErrNotFound
+	}
+	return hash[:i], uint32(id), nil
+}
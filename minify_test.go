@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/rvflash/combine"
+	"github.com/tdewolff/minify"
+	"github.com/tdewolff/minify/css"
+)
+
+// upperMinifier returns the content in upper case, only the prefix is
+// used as option to distinguish the settings.
+type upperMinifier struct {
+	Prefix string
+}
+
+// MinifierKey implements the combine.Keyer interface.
+func (u *upperMinifier) MinifierKey() string {
+	return "prefix=" + u.Prefix
+}
+
+// Minify implements the minify.Minifier interface.
+func (u *upperMinifier) Minify(_ *minify.M, w io.Writer, r io.Reader, _ map[string]string) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append([]byte(u.Prefix), bytes.ToUpper(buf)...))
+	return err
+}
+
+func TestAsset_UseMinifier(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+
+	newCSS := func(m minify.Minifier) combine.File {
+		f := c.NewCSS()
+		if m != nil {
+			if _, err := f.UseMinifier(m); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := f.AddString(".red{color:red}"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return f
+	}
+	var dt = []struct {
+		in     combine.File
+		suffix bool
+		out    string
+	}{
+		{in: newCSS(nil), out: ".red{color:red}"},
+		{in: newCSS(&upperMinifier{}), suffix: true, out: ".RED{COLOR:RED}"},
+		{in: newCSS(&upperMinifier{Prefix: "/**/"}), suffix: true, out: "/**/.RED{COLOR:RED}"},
+		{in: newCSS(&css.Minifier{Decimals: 2}), suffix: true},
+	}
+	names := make(map[string]int)
+	for i, tt := range dt {
+		name := tt.in.String()
+		if j, ok := names[name]; ok {
+			t.Errorf("%d. name already used by %d: %q", i, j, name)
+		}
+		names[name] = i
+		if strings.Contains(name, "-") != tt.suffix {
+			t.Errorf("%d. unexpected name: %q", i, name)
+		}
+		// The settings are recovered with the name.
+		f, err := c.ToAsset(combine.CSS, name)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if f.String() != name {
+			t.Errorf("%d. mismatch name: got:%q exp:%q", i, f.String(), name)
+		}
+		if tt.out == "" {
+			continue
+		}
+		w := &bytes.Buffer{}
+		if err := f.Combine(w); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if w.String() != tt.out {
+			t.Errorf("%d. content mismatch: got:%q exp:%q", i, w.String(), tt.out)
+		}
+	}
+	// Unknown settings.
+	if _, err := c.ToAsset(combine.CSS, strings.Replace(dt[1].in.String(), "-", "-1", 1)); err == nil {
+		t.Error("expected error with unknown minifier")
+	}
+	// Without settings key, the minifier is rejected.
+	if _, err := c.NewCSS().UseMinifier(minify.MinifierFunc(css.Minify)); err != combine.ErrMinifier {
+		t.Errorf("mismatch error: got:%v exp:%v", err, combine.ErrMinifier)
+	}
+	// The same settings give the same name.
+	if name := newCSS(&upperMinifier{Prefix: "/**/"}).String(); name != dt[2].in.String() {
+		t.Errorf("mismatch name: got:%q exp:%q", name, dt[2].in.String())
+	}
+	if name := newCSS(&css.Minifier{Decimals: 2}).String(); name != dt[3].in.String() {
+		t.Errorf("mismatch name: got:%q exp:%q", name, dt[3].in.String())
+	}
+}
+
+func TestBox_UseMinifier(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+
+	def := c.NewJS()
+	if err := def.AddString("var a;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := c.UseMinifier(combine.JavaScript, &upperMinifier{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	js := c.NewJS()
+	if err := js.AddString("var a;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if def.String() == js.String() {
+		t.Fatalf("expected distinct names: %q", js.String())
+	}
+	// Only the JavaScript is concerned.
+	if name := c.NewCSS().String(); strings.Contains(name, "-") {
+		t.Errorf("unexpected css name: %q", name)
+	}
+	f, err := c.Open(js.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = f.Close() }()
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(buf) != "VAR A;" {
+		t.Errorf("content mismatch: got:%q", buf)
+	}
+	// The invalid ones are rejected, the current one is kept.
+	if _, err = c.UseMinifier(combine.JavaScript, minify.MinifierFunc(css.Minify)); err != combine.ErrMinifier {
+		t.Errorf("mismatch error: got:%v exp:%v", err, combine.ErrMinifier)
+	}
+	if _, err = c.UseMinifier("text/html", &upperMinifier{}); err != combine.ErrMime {
+		t.Errorf("mismatch error: got:%v exp:%v", err, combine.ErrMime)
+	}
+	same := c.NewJS()
+	if err = same.AddString("var a;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if same.String() != js.String() {
+		t.Errorf("mismatch name: got:%q exp:%q", same.String(), js.String())
+	}
+	// Restores the default minifier.
+	if _, err = c.UseMinifier(combine.JavaScript, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name := c.NewJS().String(); strings.Contains(name, "-") {
+		t.Errorf("unexpected js name: %q", name)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import "context"
+
+// nonceKey is the key of the nonce of the Content-Security-Policy in a context.
+type nonceKey struct{}
+
+// WithNonce returns a copy of the parent context carrying this nonce
+// of the Content-Security-Policy, typically one generated by request.
+func WithNonce(parent context.Context, nonce string) context.Context {
+	return context.WithValue(parent, nonceKey{}, nonce)
+}
+
+// NonceFromContext returns the nonce stored in the context, if any.
+func NonceFromContext(ctx context.Context) (nonce string, ok bool) {
+	nonce, ok = ctx.Value(nonceKey{}).(string)
+	return
+}
+
+// Nonce returns the nonce attribute to stamp on the script and style elements
+// allowed by the Content-Security-Policy. An empty nonce is ignored on rendering.
+func Nonce(nonce string) Attr {
+	if nonce == "" {
+		return Attr{}
+	}
+	return Attr{Key: "nonce", Val: nonce}
+}
+
+// NonceAttr returns the nonce attribute with the nonce of the context.
+// Without nonce in the context, the attribute is ignored on rendering.
+// For example, with the nonce of the request:
+//
+//	js.SrcTagsAttrs("/", []combine.Attr{combine.NonceAttr(r.Context())})
+func NonceAttr(ctx context.Context) Attr {
+	nonce, _ := NonceFromContext(ctx)
+	return Nonce(nonce)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestNonceAttr(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "")
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := js.AddString("var a = 56;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddString(".black{color:#000;}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		ctx           context.Context
+		tag, src, css string
+	}{
+		{
+			ctx: context.Background(),
+			tag: `<script src="/883963153.0.2041995111.js"></script>`,
+			src: "<script src=\"/f1.js\"></script>\n<script>var a = 56;</script>",
+			css: `<link rel="stylesheet" href="/3236089261.0.css">`,
+		},
+		{
+			ctx: combine.WithNonce(context.Background(), "r4nd0m"),
+			tag: `<script src="/883963153.0.2041995111.js" nonce="r4nd0m"></script>`,
+			src: "<script src=\"/f1.js\" nonce=\"r4nd0m\"></script>\n<script nonce=\"r4nd0m\">var a = 56;</script>",
+			css: `<link rel="stylesheet" href="/3236089261.0.css" nonce="r4nd0m">`,
+		},
+		{
+			ctx: combine.WithNonce(context.Background(), `"><`),
+			tag: `<script src="/883963153.0.2041995111.js" nonce="&#34;&gt;&lt;"></script>`,
+			src: "<script src=\"/f1.js\" nonce=\"&#34;&gt;&lt;\"></script>\n<script nonce=\"&#34;&gt;&lt;\">var a = 56;</script>",
+			css: `<link rel="stylesheet" href="/3236089261.0.css" nonce="&#34;&gt;&lt;">`,
+		},
+	}
+	for i, tt := range dt {
+		nonce := combine.NonceAttr(tt.ctx)
+		if out := js.TagAttrs("", nonce); out != tt.tag {
+			t.Errorf("%d. tag mismatch: got=%q, exp=%q", i, out, tt.tag)
+		}
+		if out := js.SrcTagsAttrs("/", []combine.Attr{nonce}, "example/src"); out != tt.src {
+			t.Errorf("%d. source tags mismatch: got=%q, exp=%q", i, out, tt.src)
+		}
+		if out := css.TagAttrs("", nonce); out != tt.css {
+			t.Errorf("%d. css tag mismatch: got=%q, exp=%q", i, out, tt.css)
+		}
+	}
+	if nonce, ok := combine.NonceFromContext(combine.WithNonce(context.Background(), "abc")); !ok || nonce != "abc" {
+		t.Errorf("mismatch nonce: got=%q", nonce)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default name of the cookie listing the pushed assets.
+const defaultPushCookie = "combine_push"
+
+// Maximum length of the list of assets in the cookie.
+const maxPushCookieLen = 2048
+
+// Pusher is a middleware which collects the assets used to render the response,
+// see Collect, and pushes them with HTTP/2 server push when available.
+// Otherwise, or if the push fails, it adds a Link header to preload them.
+// The response is buffered to deal with all the assets recorded by the handler,
+// see CollectHandler.
+// To avoid to re-push the assets already in the cache of the client,
+// their paths, build version included, are remembered in a cookie.
+type Pusher struct {
+	root   Dir
+	next   http.Handler
+	cookie string
+	maxAge time.Duration
+	skip   func(r *http.Request) bool
+}
+
+// NewPusher returns a new instance of Pusher serving the requests with next.
+// The root directory is the one used to link the assets.
+func NewPusher(root Dir, next http.Handler) *Pusher {
+	return &Pusher{
+		root:   root,
+		next:   next,
+		cookie: defaultPushCookie,
+	}
+}
+
+// UseCookie defines the name and the lifetime of the cookie listing the pushed assets.
+// It should be at most the one of the assets in the cache of the client.
+// An empty name disables the cookie. By default, it's a session cookie named combine_push.
+func (p *Pusher) UseCookie(name string, maxAge time.Duration) *Pusher {
+	p.cookie = name
+	p.maxAge = maxAge
+	return p
+}
+
+// UseGuard defines a function to skip the push and the preload of the assets
+// for a request, based on its headers for example.
+func (p *Pusher) UseGuard(fn func(r *http.Request) bool) *Pusher {
+	p.skip = fn
+	return p
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (p *Pusher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.skip != nil && p.skip(r) {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	c := NewCollector(p.root)
+	cw := &collectWriter{ResponseWriter: w, before: func() {
+		p.push(w, r, c)
+	}}
+	p.next.ServeHTTP(cw, r.WithContext(WithCollector(r.Context(), c)))
+	_ = cw.finish()
+}
+
+// push pushes or preloads the collected assets not yet pushed to the client.
+func (p *Pusher) push(w http.ResponseWriter, r *http.Request, c *Collector) {
+	var (
+		pushed = p.pushed(r)
+		paths  []string
+		links  []string
+	)
+	pusher, _ := w.(http.Pusher)
+	for _, f := range c.Files() {
+		if a, ok := f.(*asset); ok {
+			if _, inline := a.autoInline(); inline {
+				continue
+			}
+		}
+		target := f.Path(p.root)
+		if target == "" || contains(pushed, target) {
+			continue
+		}
+		paths = append(paths, target)
+		if pusher != nil && pusher.Push(target, nil) == nil {
+			continue
+		}
+		links = append(links, f.Link(p.root))
+	}
+	if len(links) > 0 {
+		w.Header().Add("Link", strings.Join(links, ", "))
+	}
+	if len(paths) > 0 && p.cookie != "" {
+		http.SetCookie(w, p.newCookie(append(pushed, paths...)))
+	}
+}
+
+// pushed returns the paths of the assets already pushed to the client.
+func (p *Pusher) pushed(r *http.Request) []string {
+	if p.cookie == "" {
+		return nil
+	}
+	ck, err := r.Cookie(p.cookie)
+	if err != nil || ck.Value == "" {
+		return nil
+	}
+	return strings.Split(ck.Value, "|")
+}
+
+// newCookie returns the cookie listing these paths of assets.
+// The oldest ones are forgotten if the list is too long.
+func (p *Pusher) newCookie(paths []string) *http.Cookie {
+	value := strings.Join(paths, "|")
+	for len(value) > maxPushCookieLen && len(paths) > 1 {
+		paths = paths[1:]
+		value = strings.Join(paths, "|")
+	}
+	ck := &http.Cookie{
+		Name:     p.cookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+	}
+	if p.maxAge > 0 {
+		ck.MaxAge = int(p.maxAge.Seconds())
+	}
+	return ck
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
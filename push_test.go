@@ -0,0 +1,127 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rvflash/combine"
+)
+
+// pushRecorder is a response recorder supporting the HTTP/2 server push.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+// Push implements the http.Pusher interface.
+func (r *pushRecorder) Push(target string, _ *http.PushOptions) error {
+	r.pushed = append(r.pushed, target)
+	return nil
+}
+
+func TestPusher_ServeHTTP(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js", "f2.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddFile("f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p := combine.NewPusher("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		combine.Collect(r.Context(), css, js)
+		_, _ = io.WriteString(w, "<!doctype html>")
+	})).UseCookie("pushed", time.Hour).UseGuard(func(r *http.Request) bool {
+		return r.Header.Get("Purpose") == "prefetch"
+	})
+
+	const (
+		jsPath  = "/static/883963153.0.1831620815.js"
+		cssPath = "/static/444270761.0.css"
+	)
+	var dt = []struct {
+		push   bool
+		cookie string
+		header http.Header
+		pushed []string
+		link   string
+		set    string
+	}{
+		{
+			push:   true,
+			pushed: []string{cssPath, jsPath},
+			set:    cssPath + "|" + jsPath,
+		},
+		{
+			push:   true,
+			cookie: cssPath,
+			pushed: []string{jsPath},
+			set:    cssPath + "|" + jsPath,
+		},
+		{push: true, cookie: cssPath + "|" + jsPath},
+		{
+			link: "<" + cssPath + ">; rel=preload; as=style, <" + jsPath + ">; rel=preload; as=script",
+			set:  cssPath + "|" + jsPath,
+		},
+		{push: true, header: http.Header{"Purpose": []string{"prefetch"}}},
+	}
+	for i, tt := range dt {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "pushed", Value: tt.cookie})
+		}
+		rec := httptest.NewRecorder()
+		var w http.ResponseWriter = rec
+		pr := &pushRecorder{ResponseRecorder: rec}
+		if tt.push {
+			w = pr
+		}
+		p.ServeHTTP(w, req)
+
+		if !reflect.DeepEqual(pr.pushed, tt.pushed) {
+			t.Errorf("%d. mismatch pushed: got=%q, exp=%q", i, pr.pushed, tt.pushed)
+		}
+		if out := rec.Header().Get("Link"); out != tt.link {
+			t.Errorf("%d. mismatch link: got=%q, exp=%q", i, out, tt.link)
+		}
+		var set string
+		for _, ck := range rec.Result().Cookies() {
+			if ck.Name == "pushed" {
+				set = ck.Value
+			}
+		}
+		if set != tt.set {
+			t.Errorf("%d. mismatch cookie: got=%q, exp=%q", i, set, tt.set)
+		}
+		if rec.Body.String() != "<!doctype html>" {
+			t.Errorf("%d. mismatch body: got=%q", i, rec.Body.String())
+		}
+	}
+	// A new build version is pushed again.
+	c.UseBuildVersion("v2")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "pushed", Value: cssPath + "|" + jsPath})
+	pr := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	p.ServeHTTP(pr, req)
+	exp := []string{"/static/v2/444270761.0.css", "/static/v2/883963153.0.1831620815.js"}
+	if !reflect.DeepEqual(pr.pushed, exp) {
+		t.Errorf("mismatch pushed: got=%q, exp=%q", pr.pushed, exp)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ServeHTTP implements the http.Handler interface to serve the assets.
+// It can be used instead of http.FileServer(box) to get
+// a 503 Service Unavailable status code when the build of the asset
+// can not start in time, see UseBuildLimit.
+// On the first demand of an asset, its content is sent while it's built.
+// The build never waits for the client: if it falls behind, the stream is
+// dropped and the rest of the content is sent from the static file once built.
+// The static file is only kept if the build succeeds. Otherwise,
+// the response is aborted if it has already started.
+func (b *Box) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ext := companion(r.URL.Path)
+	if !b.hasCompanion(ext) {
+		http.NotFound(w, r)
+		return
+	}
+	a, err := b.toAsset(basename(name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var d *Static
+	if r.Method == http.MethodGet && ext == "" {
+		sw := newStreamWriter(w, r.URL.Path)
+		defer sw.wait()
+		d, err = b.stream(a, sw)
+		if sw.wait(); sw.started {
+			if err != nil {
+				// The response is incomplete.
+				panic(http.ErrAbortHandler)
+			}
+			if sw.isDropped() {
+				serveRest(d.Link, sw.sent, w)
+			}
+			return
+		}
+	} else {
+		d, err = b.static(a)
+	}
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	f, err := os.Open(d.Link + ext)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if ext == mapExt {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	http.ServeContent(w, r, path.Base(r.URL.Path), fi.ModTime(), f)
+}
+
+// serveError replies with the status code matching the error.
+// During the back-off of a failed build, the asset is unavailable until its next attempt.
+func serveError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch e := err.(type) {
+	case *BuildError:
+		if d := time.Until(e.Retry); d > 0 {
+			code = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+		}
+	default:
+		if err == ErrBusy {
+			code = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", "1")
+		}
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// serveRest sends the content of the file from this offset,
+// the beginning having already been sent.
+func serveRest(name string, offset int64, w io.Writer) {
+	f, err := os.Open(name)
+	if err == nil {
+		defer func() { _ = f.Close() }()
+		if _, err = f.Seek(offset, io.SeekStart); err == nil {
+			_, err = io.Copy(w, f)
+		}
+	}
+	if err != nil {
+		// The response is incomplete.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Maximum size of the content waiting to be sent to the client during a build.
+const maxStreamBuffer = 256 << 10
+
+// streamWriter sends the content of the asset during its build.
+// The content is buffered and sent by an other goroutine, so the build is never
+// blocked by the client. If too much content is waiting, the stream is dropped.
+// The errors of the client are ignored to not fail the build.
+type streamWriter struct {
+	w    http.ResponseWriter
+	name string
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	closed  bool
+	dropped bool
+
+	once sync.Once
+	done chan struct{}
+	// Only known at the end of the stream, see wait.
+	started bool
+	sent    int64
+}
+
+func newStreamWriter(w http.ResponseWriter, name string) *streamWriter {
+	sw := &streamWriter{w: w, name: name, done: make(chan struct{})}
+	sw.cond = sync.NewCond(&sw.mu)
+	go sw.relay()
+	return sw
+}
+
+// Write implements the io.Writer interface.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	switch {
+	case w.closed || w.dropped:
+	case len(w.buf) > 0 && len(w.buf)+len(p) > maxStreamBuffer:
+		// The client falls behind.
+		w.buf, w.dropped = nil, true
+	default:
+		w.buf = append(w.buf, p...)
+	}
+	w.mu.Unlock()
+	w.cond.Signal()
+	return len(p), nil
+}
+
+// relay sends the content to the client until the end of the stream.
+func (w *streamWriter) relay() {
+	defer close(w.done)
+	for {
+		p, ok := w.next()
+		if !ok {
+			return
+		}
+		if !w.started {
+			w.started = true
+			w.w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(w.name)))
+			w.w.WriteHeader(http.StatusOK)
+		}
+		n, err := w.w.Write(p)
+		if w.sent += int64(n); err != nil {
+			w.drop()
+			return
+		}
+	}
+}
+
+// next returns the content waiting to be sent, or false at the end of the stream.
+func (w *streamWriter) next() ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.buf) == 0 && !w.closed && !w.dropped {
+		w.cond.Wait()
+	}
+	p := w.buf
+	w.buf = nil
+	return p, len(p) > 0
+}
+
+func (w *streamWriter) drop() {
+	w.mu.Lock()
+	w.buf, w.dropped = nil, true
+	w.mu.Unlock()
+}
+
+func (w *streamWriter) isDropped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// wait ends the stream and waits for the content already received to be sent.
+func (w *streamWriter) wait() {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		w.cond.Signal()
+	})
+	<-w.done
+}
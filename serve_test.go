@@ -0,0 +1,294 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rvflash/combine"
+)
+
+func TestBox_ServeHTTP(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&fakeHTTPClient{})
+	// Creates a HTTP test server.
+	ts := httptest.NewServer(c)
+	defer ts.Close()
+
+	js := c.NewJS()
+	if err := js.AddString("var a=56;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/fail.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		path,
+		body,
+		contentType string
+		statusCode int
+	}{
+		{body: "404 page not found\n", statusCode: 404},
+		{path: "/1/" + js.String(), body: "var a=56;", contentType: "text/javascript; charset=utf-8", statusCode: 200},
+		{path: "/" + css.String(), body: "Internal Server Error\n", statusCode: 500},
+	}
+	for i, tt := range dt {
+		resp, err := http.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if resp.StatusCode != tt.statusCode {
+			t.Errorf("%d. unexpected status code: got:%d exp:%d", i, resp.StatusCode, tt.statusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); tt.contentType != "" && ct != tt.contentType {
+			t.Errorf("%d. unexpected content type: got:%q exp:%q", i, ct, tt.contentType)
+		}
+		out, _ := ioutil.ReadAll(resp.Body)
+		if string(out) != tt.body {
+			t.Errorf("%d. unexpected content: got:%q exp:%q", i, out, tt.body)
+		}
+		_ = resp.Body.Close()
+	}
+}
+
+func TestBox_UseBuildLimit(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	hc := newBlockHTTPClient()
+	c.UseHTTPClient(hc).UseBuildLimit(1, time.Millisecond)
+	// Creates a HTTP test server.
+	ts := httptest.NewServer(c)
+	defer ts.Close()
+
+	// Never leaves the first build blocked.
+	defer hc.Release()
+
+	slow := c.NewJS()
+	if err := slow.AddURL("http://www.js.com/f1.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	js := c.NewJS()
+	if err := js.AddString("var a=56;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Get(ts.URL + "/" + slow.String())
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	// Waits for the first build to hold the only slot.
+	select {
+	case <-hc.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the start of the first build")
+	}
+	resp, err := http.Get(ts.URL + "/" + js.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code: got:%d exp:%d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if s := c.Stats(); s.Rejected != 1 {
+		t.Errorf("unexpected rejected builds: got:%d exp:%d", s.Rejected, 1)
+	}
+	// Ends the first build.
+	hc.Release()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the end of the first build")
+	}
+	// Now, the build can start.
+	resp, err = http.Get(ts.URL + "/" + js.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code: got:%d exp:%d", resp.StatusCode, http.StatusOK)
+	}
+	if s := c.Stats(); s.Queued != 0 || s.Building != 0 {
+		t.Errorf("unexpected activity: got:%+v", s)
+	}
+}
+
+func TestBox_ServeHTTP_Backoff(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&fakeHTTPClient{}).UseBackoff(time.Minute)
+	// Creates a HTTP test server.
+	ts := httptest.NewServer(c)
+	defer ts.Close()
+
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/fail.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Until the next attempt, the asset is unavailable.
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(ts.URL + "/" + css.String())
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%d. unexpected status code: got:%d exp:%d", i, resp.StatusCode, http.StatusServiceUnavailable)
+		}
+		if ra := resp.Header.Get("Retry-After"); ra != "60" {
+			t.Errorf("%d. unexpected retry after: got:%q exp:%q", i, ra, "60")
+		}
+	}
+}
+
+func TestBox_ServeHTTP_Abort(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&slowHTTPClient{})
+	// Creates a HTTP test server.
+	ts := httptest.NewServer(c)
+	defer ts.Close()
+
+	js := c.NewJS()
+	if err := js.AddString("var a=56;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := js.AddURL("http://www.js.com/fail.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The response has started with the first part, then it is aborted.
+	resp, err := http.Get(ts.URL + "/" + js.String())
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// Nothing has been kept.
+	if _, ok := c.Load(js); ok {
+		t.Error("unexpected static")
+	}
+}
+
+func TestBox_ServeHTTP_SlowClient(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+
+	css := c.NewCSS()
+	for i := 0; i < 3; i++ {
+		// Each part exceeds the content waiting for a client.
+		s := strings.Repeat(".a"+strconv.Itoa(i)+"{color:red}", 25000)
+		if err := css.AddString(s); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+	}
+	w := &blockResponseWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.ServeHTTP(w, httptest.NewRequest("GET", "/"+css.String(), nil))
+	}()
+	select {
+	case <-w.writing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the start of the response")
+	}
+	// The build does not wait for the client.
+	built := make(chan error, 1)
+	go func() {
+		f, err := c.Open(css.String())
+		if err == nil {
+			_ = f.Close()
+		}
+		built <- err
+	}()
+	select {
+	case err := <-built:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		close(w.release)
+		t.Fatal("expected the end of the build")
+	}
+	close(w.release)
+	<-done
+
+	exp := &bytes.Buffer{}
+	if err := css.Combine(exp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != exp.String() {
+		t.Errorf("unexpected response: got:%d with %d bytes exp:%d bytes", w.Code, w.Body.Len(), exp.Len())
+	}
+}
+
+// blockResponseWriter blocks the writes until the release of the test.
+type blockResponseWriter struct {
+	*httptest.ResponseRecorder
+	writing, release chan struct{}
+	once             sync.Once
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *blockResponseWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+// blockHTTPClient blocks the requests until the release of the test.
+type blockHTTPClient struct {
+	started, release chan struct{}
+	start, end       sync.Once
+	fakeClient       fakeHTTPClient
+}
+
+func newBlockHTTPClient() *blockHTTPClient {
+	return &blockHTTPClient{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+// Get mocks the method of same name of the http package.
+func (c *blockHTTPClient) Get(url string) (*http.Response, error) {
+	c.start.Do(func() { close(c.started) })
+	<-c.release
+	return c.fakeClient.Get(url)
+}
+
+// Release releases the pending and next requests.
+func (c *blockHTTPClient) Release() {
+	c.end.Do(func() { close(c.release) })
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sourceMap is an index map (source map version 3) with a section by part.
+// The minifier does not provide the mapping of its tokens, so the start
+// of each line of a part is mapped to the start of its source.
+// In development mode, the parts are not minified, so each line is mapped
+// to the start of the same line in its source.
+type sourceMap struct {
+	file     string
+	dev      bool
+	line     int
+	column   int
+	sections []section
+}
+
+type section struct {
+	Offset offset  `json:"offset"`
+	Map    partMap `json:"map"`
+}
+
+type offset struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type partMap struct {
+	Version        int       `json:"version"`
+	SourceRoot     string    `json:"sourceRoot,omitempty"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent,omitempty"`
+	Names          []string  `json:"names"`
+	Mappings       string    `json:"mappings"`
+}
+
+// mapSource is the source of a part of an asset in a source map.
+type mapSource struct {
+	root    string
+	name    string
+	content *string
+}
+
+func newSourceMap(file string, dev bool) *sourceMap {
+	return &sourceMap{file: file, dev: dev}
+}
+
+// add adds a section for the source of this output.
+func (m *sourceMap) add(src mapSource, out []byte) {
+	if len(out) == 0 {
+		return
+	}
+	// The last line break only separates the parts.
+	lines := 1 + bytes.Count(bytes.TrimSuffix(out, []byte("\n")), []byte("\n"))
+	next := ";AAAA"
+	if m.dev {
+		// Moves to the next line of the source.
+		next = ";AACA"
+	}
+	s := section{
+		Offset: offset{Line: m.line, Column: m.column},
+		Map: partMap{
+			Version:    3,
+			SourceRoot: src.root,
+			Sources:    []string{src.name},
+			Names:      []string{},
+			Mappings:   "AAAA" + strings.Repeat(next, lines-1),
+		},
+	}
+	if src.content != nil {
+		s.Map.SourcesContent = []*string{src.content}
+	}
+	m.sections = append(m.sections, s)
+	m.move(out)
+}
+
+// move moves the offset of the next section at the end of this output.
+func (m *sourceMap) move(out []byte) {
+	if i := bytes.LastIndexByte(out, '\n'); i < 0 {
+		m.column += utf8.RuneCount(out)
+	} else {
+		m.line += bytes.Count(out, []byte("\n"))
+		m.column = utf8.RuneCount(out[i+1:])
+	}
+}
+
+// comment returns the comment to link the asset to its source map.
+func (m *sourceMap) comment(kind string) string {
+	url := m.file + mapExt
+	if kind == CSS {
+		return "\n/*# sourceMappingURL=" + url + " */"
+	}
+	return "\n//# sourceMappingURL=" + url
+}
+
+// WriteTo implements the io.WriterTo interface.
+func (m *sourceMap) WriteTo(w io.Writer) (int64, error) {
+	sections := m.sections
+	if sections == nil {
+		sections = []section{}
+	}
+	buf, err := json.Marshal(struct {
+		Version  int       `json:"version"`
+		File     string    `json:"file"`
+		Sections []section `json:"sections"`
+	}{
+		Version:  3,
+		File:     m.file,
+		Sections: sections,
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// mapSource returns the source in the source map of the part at this index.
+// The original content is only given for the inline and remote sources.
+// The path of a file is relative to the source directory, to not expose the server's one.
+func (a *asset) mapSource(index int, r *raw, c *cached) mapSource {
+	switch r.kind {
+	case fileSrc:
+		name, err := filepath.Rel(a.reg.src.String(), r.String())
+		if err != nil {
+			name = filepath.Base(r.String())
+		}
+		return mapSource{root: a.reg.sourceRoot, name: filePathToPath(name)}
+	case onlineSrc:
+		s := string(c.src)
+		return mapSource{name: r.String(), content: &s}
+	}
+	s := r.String()
+	return mapSource{
+		name:    path.Join("inline", strconv.Itoa(index)+a.ext()),
+		content: &s,
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestBox_UseSourceMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combine")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	name := filepath.Join(dir, "f.css")
+	if err = ioutil.WriteFile(name, []byte(".b{color:red}"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Creates the registry
+	c := combine.NewBox(combine.Dir(dir), combine.Dir(dir))
+	defer func() { _ = c.Close() }()
+	c.UseHTTPClient(&etagHTTPClient{})
+
+	css := c.NewCSS()
+	if err = css.AddString(".a{color:red}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = css.AddFile("f.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = css.AddURL("http://www.css.com/f.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	read := func(name string) string {
+		f, err := c.Open(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer func() { _ = f.Close() }()
+		buf, _ := ioutil.ReadAll(f)
+		return string(buf)
+	}
+	// Disabled by default.
+	if _, err = c.Open(css.String() + ".map"); err != os.ErrNotExist {
+		t.Fatalf("mismatch error: got:%v exp:%v", err, os.ErrNotExist)
+	}
+	c.UseSourceMap(true).UseSourceRoot("/src/")
+
+	exp := ".a{color:red}.b{color:red}.e1{color:red}\n/*# sourceMappingURL=" + css.String() + ".map */"
+	if out := read(css.String()); out != exp {
+		t.Errorf("mismatch content: got:%q exp:%q", out, exp)
+	}
+	var sm struct {
+		Version  int
+		File     string
+		Sections []struct {
+			Offset struct {
+				Line, Column int
+			}
+			Map struct {
+				Version        int
+				SourceRoot     string
+				Sources        []string
+				SourcesContent []*string
+				Mappings       string
+			}
+		}
+	}
+	if err = json.Unmarshal([]byte(read(css.String()+".map")), &sm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sm.Version != 3 || sm.File != css.String() || len(sm.Sections) != 3 {
+		t.Fatalf("unexpected source map: %+v", sm)
+	}
+	var dt = []struct {
+		column  int
+		root    string
+		source  string
+		content string
+	}{
+		{column: 0, source: "inline/0.css", content: ".a{color:red}"},
+		// The path of the server is not exposed.
+		{column: 13, root: "/src/", source: "f.css"},
+		{column: 26, source: "http://www.css.com/f.css", content: ".e1{color:red}"},
+	}
+	for i, tt := range dt {
+		s := sm.Sections[i]
+		if s.Offset.Line != 0 || s.Offset.Column != tt.column {
+			t.Errorf("%d. mismatch offset: got:%+v exp:%d", i, s.Offset, tt.column)
+		}
+		if s.Map.Version != 3 || s.Map.Mappings != "AAAA" {
+			t.Errorf("%d. unexpected map: %+v", i, s.Map)
+		}
+		if s.Map.SourceRoot != tt.root {
+			t.Errorf("%d. mismatch source root: got:%q exp:%q", i, s.Map.SourceRoot, tt.root)
+		}
+		if !reflect.DeepEqual(s.Map.Sources, []string{tt.source}) {
+			t.Errorf("%d. mismatch sources: got:%q exp:%q", i, s.Map.Sources, tt.source)
+		}
+		var content string
+		if len(s.Map.SourcesContent) == 1 {
+			content = *s.Map.SourcesContent[0]
+		}
+		if content != tt.content {
+			t.Errorf("%d. mismatch content: got:%q exp:%q", i, content, tt.content)
+		}
+	}
+}
+
+func TestBox_UseSourceMap_DevMode(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("", "./example/combine")
+	defer func() { _ = c.Close() }()
+	c.UseHTTPClient(&etagHTTPClient{}).UseDevMode(true)
+
+	// Caches the remote source without source map.
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/f.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := c.Warm(context.Background(), css).Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c.UseSourceMap(true)
+
+	css = c.NewCSS()
+	if err := css.AddString(".a {\n\tcolor: red;\n}"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := css.AddURL("http://www.css.com/f.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f, err := c.Open(css.String() + ".map")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = f.Close() }()
+	var sm struct {
+		Sections []struct {
+			Offset struct {
+				Line, Column int
+			}
+			Map struct {
+				SourcesContent []*string
+				Mappings       string
+			}
+		}
+	}
+	if err = json.NewDecoder(f).Decode(&sm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(sm.Sections) != 2 {
+		t.Fatalf("unexpected source map: %+v", sm)
+	}
+	var dt = []struct {
+		line     int
+		mappings string
+		content  string
+	}{
+		// Each part follows its banner.
+		{line: 1, mappings: "AAAA;AACA;AACA", content: ".a {\n\tcolor: red;\n}"},
+		{line: 5, mappings: "AAAA", content: ".e1{color:red}"},
+	}
+	for i, tt := range dt {
+		s := sm.Sections[i]
+		if s.Offset.Line != tt.line || s.Offset.Column != 0 {
+			t.Errorf("%d. mismatch offset: got:%+v exp:%d", i, s.Offset, tt.line)
+		}
+		if s.Map.Mappings != tt.mappings {
+			t.Errorf("%d. mismatch mappings: got:%q exp:%q", i, s.Map.Mappings, tt.mappings)
+		}
+		var content string
+		if len(s.Map.SourcesContent) == 1 {
+			content = *s.Map.SourcesContent[0]
+		}
+		if content != tt.content {
+			t.Errorf("%d. mismatch content: got:%q exp:%q", i, content, tt.content)
+		}
+	}
+}
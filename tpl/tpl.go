@@ -0,0 +1,108 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+// Package tpl provides the functions to declare and render combined assets
+// inside the templates of the html/template package.
+package tpl
+
+import (
+	"errors"
+	"html/template"
+	"strings"
+
+	"github.com/rvflash/combine"
+)
+
+// ErrAttr is returned if an attribute is neither a combine.Attr or a string.
+var ErrAttr = errors.New("invalid attribute")
+
+// FuncMap returns the functions to declare and render the assets of the box
+// inside a template. The root directory is the one used to link them.
+//
+//	combine_css    returns a new CSS asset with the given sources.
+//	combine_js     returns a new JavaScript asset with the given sources.
+//	combine_tag    returns the tag of an asset, with optional attributes.
+//	combine_src    returns the path of the combined version of an asset.
+//	combine_inline returns the tag of an asset rendered inline, with optional attributes.
+//	combine_nonce  returns the nonce attribute with the given nonce, see combine.Nonce.
+//
+// The sources are file names, relative to the source directory of the box,
+// or URLs. The attributes are combine.Attr or strings as "key=value" or "key".
+// Those able to run a script, like the event handlers or style, are dropped.
+// For example:
+//
+//	{{ combine_css "reset.css" "https://example.com/app.css" | combine_tag }}
+//	{{ combine_tag (combine_js "app.js") "defer" (combine_nonce .Nonce) }}
+func FuncMap(b *combine.Box, root combine.Dir) template.FuncMap {
+	return template.FuncMap{
+		"combine_css": func(src ...string) (combine.File, error) {
+			return newFile(b.NewCSS(), src)
+		},
+		"combine_js": func(src ...string) (combine.File, error) {
+			return newFile(b.NewJS(), src)
+		},
+		"combine_tag": func(f combine.File, attrs ...interface{}) (template.HTML, error) {
+			at, err := toAttrs(attrs)
+			if err != nil {
+				return "", err
+			}
+			// The values of the attributes are already escaped.
+			return template.HTML(f.TagAttrs(root, at...)), nil
+		},
+		"combine_src": func(f combine.File) template.URL {
+			return template.URL(f.Path(root))
+		},
+		"combine_inline": func(f combine.File, attrs ...interface{}) (template.HTML, error) {
+			at, err := toAttrs(attrs)
+			if err != nil {
+				return "", err
+			}
+			// The content is escaped to prevent the end of the element.
+			s, err := f.Inline(at...)
+			return template.HTML(s), err
+		},
+		"combine_nonce": combine.Nonce,
+	}
+}
+
+// newFile adds the sources to the asset: URLs as URL and the others as files.
+func newFile(f combine.File, src []string) (combine.File, error) {
+	for _, s := range src {
+		var err error
+		if isURL(s) {
+			err = f.AddURL(s)
+		} else {
+			err = f.AddFile(s)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func isURL(s string) bool {
+	return strings.Contains(s, "://") || strings.HasPrefix(s, "data:")
+}
+
+// toAttrs converts the attributes given in a template.
+func toAttrs(in []interface{}) ([]combine.Attr, error) {
+	attrs := make([]combine.Attr, 0, len(in))
+	for _, v := range in {
+		switch a := v.(type) {
+		case combine.Attr:
+			attrs = append(attrs, a)
+		case string:
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) == 1 {
+				attrs = append(attrs, combine.Attr{Key: kv[0]})
+			} else {
+				attrs = append(attrs, combine.Attr{Key: kv[0], Val: kv[1]})
+			}
+		default:
+			return nil, ErrAttr
+		}
+	}
+	return attrs, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package tpl_test
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+
+	"github.com/rvflash/combine"
+	"github.com/rvflash/combine/tpl"
+)
+
+func TestFuncMap(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("../example/src", "../example/combine")
+	defer func() { _ = c.Close() }()
+	// Disables the build version to avoid variance.
+	c.UseBuildVersion("")
+
+	var dt = []struct {
+		in   string
+		data interface{}
+		out  string
+		err  bool
+	}{
+		{
+			in:  `{{ combine_js "f1.js" "f2.js" | combine_tag }}`,
+			out: `<script src="/min/215747867.1356496811.0.js"></script>`,
+		},
+		{
+			in:   `{{ combine_tag (combine_js "f1.js") "defer" "id=a&b" .Nonce }}`,
+			data: map[string]combine.Attr{"Nonce": combine.Nonce("abc")},
+			out:  `<script src="/min/1572244678.0.js" defer id="a&amp;b" nonce="abc"></script>`,
+		},
+		{
+			in:   `{{ combine_tag (combine_js "f1.js") "defer" (combine_nonce .Nonce) }}`,
+			data: map[string]string{"Nonce": "abc"},
+			out:  `<script src="/min/1572244678.0.js" defer nonce="abc"></script>`,
+		},
+		{
+			in:   `{{ combine_tag (combine_js "f1.js") .A "style=x" "defer" }}`,
+			data: map[string]string{"A": "onload=alert(document.cookie)"},
+			out:  `<script src="/min/1572244678.0.js" defer></script>`,
+		},
+		{
+			in:  `{{ combine_tag (combine_js "f1.js") (combine_nonce "") }}`,
+			out: `<script src="/min/1572244678.0.js"></script>`,
+		},
+		{
+			in:  `<link rel="preload" href="{{ combine_css "f1.css" | combine_src }}">`,
+			out: `<link rel="preload" href="/min/1416687896.0.css">`,
+		},
+		{
+			in:  `{{ combine_css "data:text/css,.a{color:red}" | combine_inline }}`,
+			out: `<style>.a{color:red}</style>`,
+		},
+		{in: `{{ combine_css "missing.css" | combine_tag }}`, err: true},
+		{in: `{{ combine_tag (combine_js "f1.js") 1 }}`, err: true},
+	}
+	for i, tt := range dt {
+		tmpl, err := template.New("test").Funcs(tpl.FuncMap(c, "/min/")).Parse(tt.in)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		w := &bytes.Buffer{}
+		if err = tmpl.Execute(w, tt.data); (err != nil) != tt.err {
+			t.Fatalf("%d. unexpected error: %v", i, err)
+		}
+		if !tt.err && w.String() != tt.out {
+			t.Errorf("%d. content mismatch: got=%q, exp=%q", i, w.String(), tt.out)
+		}
+	}
+}
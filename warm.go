@@ -0,0 +1,91 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WarmResult is the result of the build of one asset.
+type WarmResult struct {
+	// Name is the name of the asset.
+	Name string
+	// Duration is the time spent to build it.
+	Duration time.Duration
+	// Err is the error occurred during its build, if any.
+	Err error
+}
+
+// WarmReport lists the results of the build of the assets in the order of the demand.
+type WarmReport []WarmResult
+
+// Err returns the first error of the report or nil if all the assets have been built.
+func (r WarmReport) Err() error {
+	for _, res := range r {
+		if res.Err != nil {
+			return res.Err
+		}
+	}
+	return nil
+}
+
+// Warm builds the static version of the given assets ahead of their first demand.
+// The number of assets built at the same time is limited, see UseWarmLimit.
+// Once the context is done, the assets not yet started are not built.
+func (b *Box) Warm(ctx context.Context, files ...File) WarmReport {
+	var (
+		wg  sync.WaitGroup
+		res = make(WarmReport, len(files))
+		sem = make(chan struct{}, b.warmLimit)
+	)
+	for i, f := range files {
+		res[i].Name = f.String()
+		if res[i].Err = ctx.Err(); res[i].Err != nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			res[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(r *WarmResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			r.Err = b.warm(r.Name)
+			r.Duration = time.Since(start)
+		}(&res[i])
+	}
+	wg.Wait()
+	return res
+}
+
+func (b *Box) warm(name string) error {
+	if name == "" {
+		return ErrUnexpectedEOF
+	}
+	a, err := b.toAsset(basename(name))
+	if err != nil {
+		return err
+	}
+	_, err = b.static(a)
+	return err
+}
+
+// UseWarmLimit defines the maximum number of assets to build at the same time with Warm.
+// By default, it's the number of logical CPUs.
+func (b *Box) UseWarmLimit(n int) *Box {
+	if n < 1 {
+		n = 1
+	}
+	b.warmLimit = n
+	return b
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Hervé Gouchet. All rights reserved.
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package combine_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rvflash/combine"
+)
+
+func TestBox_Warm(t *testing.T) {
+	// Creates the registry
+	c := combine.NewBox("./example/src", "./example/combine")
+	defer func() { _ = c.Close() }()
+	// Mocks the HTTP client.
+	c.UseHTTPClient(&fakeHTTPClient{}).UseWarmLimit(2)
+
+	js := c.NewJS()
+	if err := js.AddFile("f1.js", "f2.js"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	css := c.NewCSS()
+	if err := css.AddURL("http://www.css.com/f1.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fail := c.NewCSS()
+	if err := fail.AddURL("http://www.css.com/fail.css"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var dt = []struct {
+		in  []combine.File
+		ctx context.Context
+		err bool
+	}{
+		{ctx: context.Background()},
+		{in: []combine.File{js, css}, ctx: context.Background()},
+		{in: []combine.File{js, fail, css, c.NewJS()}, ctx: context.Background(), err: true},
+	}
+	for i, tt := range dt {
+		res := c.Warm(tt.ctx, tt.in...)
+		if len(res) != len(tt.in) {
+			t.Fatalf("%d. mismatch report size: got:%d exp:%d", i, len(res), len(tt.in))
+		}
+		if err := res.Err(); (err != nil) != tt.err {
+			t.Errorf("%d. unexpected error: %v", i, err)
+		}
+		for k, r := range res {
+			if r.Name != tt.in[k].String() {
+				t.Errorf("%d. mismatch name: got:%q exp:%q", i, r.Name, tt.in[k].String())
+			}
+		}
+	}
+	// The assets are available.
+	if d, ok := c.Load(js); !ok || d.Link == "" {
+		t.Error("expected static")
+	}
+	if _, ok := c.Load(fail); ok {
+		t.Error("unexpected static")
+	}
+	// Cancelled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Warm(ctx, js).Err(); err != context.Canceled {
+		t.Errorf("mismatch error: got:%v exp:%v", err, context.Canceled)
+	}
+}